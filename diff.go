@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/fatih/color"
+)
+
+// diffEntry is one difference between two sets of statements: an
+// assignment only on the left (-), only on the right (+), or present on
+// both sides with different values (~).
+type diffEntry struct {
+	marker byte
+	s      statement
+	old    token
+}
+
+// splitAssignment splits an assignment statement into its path and value
+// tokens. ok is false for statements that aren't assignments, such as
+// comments and attributes.
+func splitAssignment(s statement) (path statement, value token, ok bool) {
+	for i, t := range s {
+		switch {
+		case t.typ == typAt:
+			return nil, token{}, false
+		case t.typ == typEquals && i+1 < len(s):
+			return s[:i], s[i+1], true
+		}
+	}
+	return nil, token{}, false
+}
+
+// diffStatements compares two sets of statements by path, returning the
+// differences in sorted path order. Comments are ignored.
+func diffStatements(a, b statements) []diffEntry {
+	left := make(map[string]token)
+	for _, s := range a {
+		if path, value, ok := splitAssignment(s); ok {
+			left[statementToString(path)] = value
+		}
+	}
+
+	var entries []diffEntry
+	seen := make(map[string]bool)
+	for _, s := range b {
+		path, value, ok := splitAssignment(s)
+		if !ok {
+			continue
+		}
+		key := statementToString(path)
+		seen[key] = true
+		switch old, found := left[key]; {
+		case !found:
+			entries = append(entries, diffEntry{marker: '+', s: s})
+		case old.text != value.text:
+			entries = append(entries, diffEntry{marker: '~', s: s, old: old})
+		}
+	}
+	for _, s := range a {
+		if path, _, ok := splitAssignment(s); ok && !seen[statementToString(path)] {
+			entries = append(entries, diffEntry{marker: '-', s: s})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return statements{entries[i].s, entries[j].s}.Less(0, 1)
+	})
+	return entries
+}
+
+// formatDiffEntry renders e as a marked grin assignment. Changed values
+// show the old value followed by the new one.
+func formatDiffEntry(e diffEntry, opts int) string {
+	conv, format := statementToColorString, token.formatColor
+	if opts&optMonochrome > 0 {
+		conv, format = statementToString, token.format
+	}
+
+	marker := string(e.marker)
+	if opts&optMonochrome == 0 {
+		marker = markerColor(e.marker).Sprint(marker)
+	}
+
+	if e.marker != '~' {
+		return marker + " " + conv(e.s)
+	}
+	path, value, _ := splitAssignment(e.s)
+	return marker + " " + conv(path) + format(token{text: " = ", typ: typEquals}) +
+		format(e.old) + " -> " + format(value) + format(token{text: ";", typ: typSemi})
+}
+
+// markerColor returns the token color a diff marker is written in.
+func markerColor(marker byte) *color.Color {
+	switch marker {
+	case '+':
+		return literalColor
+	case '-':
+		return punctColor
+	default:
+		return strColor
+	}
+}
+
+// diffCommand implements `grin diff A B`: it compares two files, read
+// with read, by path and prints the assignments that were removed (-),
+// added (+) or changed (~) going from A to B. Either file may be "-" for
+// stdin.
+func diffCommand(args []string, stdin io.Reader, w io.Writer, read readerFn, opts int) (int, error) {
+	if len(args) != 2 {
+		return exitInvalidOptions, errors.New("usage: grin diff FILE FILE")
+	}
+	if args[0] == "-" && args[1] == "-" {
+		return exitInvalidOptions, errors.New("only one side of a diff can be read from stdin")
+	}
+
+	sides := make([]statements, 2)
+	for i, filename := range args {
+		ss, code, err := readDiffFile(read, filename, stdin, opts)
+		if err != nil {
+			return code, err
+		}
+		sides[i] = ss
+	}
+
+	entries := diffStatements(sides[0], sides[1])
+	for _, e := range entries {
+		if _, err := fmt.Fprintln(w, formatDiffEntry(e, opts)); err != nil {
+			return exitReadInput, err
+		}
+	}
+
+	if len(entries) > 0 {
+		return exitDifferent, nil
+	}
+	return exitOK, nil
+}
+
+// readDiffFile reads the statements of a file with read, or of stdin if
+// filename is "-", returning the exit code to use on failure.
+func readDiffFile(read readerFn, filename string, stdin io.Reader, opts int) (statements, int, error) {
+	r := stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, exitOpenFile, err
+		}
+		defer f.Close() //nolint:errcheck // best-effort close on read-only file
+		r = f
+	}
+
+	ss, err := read(r, opts)
+	if err != nil {
+		return nil, exitFormStatements, fmt.Errorf("%s: %w", filename, err)
+	}
+	return ss, exitOK, nil
+}
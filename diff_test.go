@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitAssignment(t *testing.T) {
+	s, err := lexPath(`ini.database.port`)
+	if err != nil {
+		t.Fatalf("lexPath error: %v", err)
+	}
+	path, value, ok := splitAssignment(s.withStringValue("5432"))
+	if !ok {
+		t.Fatal("splitAssignment: expected an assignment")
+	}
+	if got := statementToString(path); got != "ini.database.port" {
+		t.Errorf("path = %q, want %q", got, "ini.database.port")
+	}
+	if value.text != `"5432"` {
+		t.Errorf("value = %q, want %q", value.text, `"5432"`)
+	}
+
+	if _, _, ok := splitAssignment(s.withComment("; note")); ok {
+		t.Error("splitAssignment: comment statement should not be an assignment")
+	}
+	if _, _, ok := splitAssignment(s.withAttribute("continuation").withStringValue("indent")); ok {
+		t.Error("splitAssignment: attribute statement should not be an assignment")
+	}
+}
+
+func TestDiffStatements(t *testing.T) {
+	a, err := readINI(strings.NewReader("[database]\nhost = localhost\nport = 5432\n\n[old]\nx = 1\n"), 0)
+	if err != nil {
+		t.Fatalf("readINI error: %v", err)
+	}
+	b, err := readINI(strings.NewReader("[database]\nport = 5433\nhost = localhost\nuser = admin\n"), 0)
+	if err != nil {
+		t.Fatalf("readINI error: %v", err)
+	}
+
+	var got []string
+	for _, e := range diffStatements(a, b) {
+		got = append(got, formatDiffEntry(e, optMonochrome))
+	}
+	want := []string{
+		`~ ini.database.port = "5432" -> "5433";`,
+		`+ ini.database.user = "admin";`,
+		`- ini.old = {};`,
+		`- ini.old.x = "1";`,
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diff:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDiffStatementsIgnoresComments(t *testing.T) {
+	a, err := readINI(strings.NewReader("; one\nkey = value\n"), optComments)
+	if err != nil {
+		t.Fatalf("readINI error: %v", err)
+	}
+	b, err := readINI(strings.NewReader("; two\nkey = value\n"), optComments)
+	if err != nil {
+		t.Fatalf("readINI error: %v", err)
+	}
+
+	if entries := diffStatements(a, b); len(entries) != 0 {
+		t.Errorf("expected no differences, got %d", len(entries))
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.ini")
+	b := filepath.Join(dir, "b.ini")
+	if err := os.WriteFile(a, []byte("[app]\nname = one\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	if err := os.WriteFile(b, []byte("[app]\nname = two\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	exitCode, err := diffCommand([]string{a, b}, nil, &buf, readINI, optMonochrome)
+	if err != nil {
+		t.Fatalf("diffCommand error: %v", err)
+	}
+	if exitCode != exitDifferent {
+		t.Errorf("diffCommand exit code = %d, want %d", exitCode, exitDifferent)
+	}
+	if want := "~ ini.app.name = \"one\" -> \"two\";\n"; buf.String() != want {
+		t.Errorf("diffCommand output = %q, want %q", buf.String(), want)
+	}
+
+	// Identical input, one side from stdin
+	buf.Reset()
+	exitCode, err = diffCommand([]string{"-", a}, strings.NewReader("[app]\nname = one\n"), &buf, readINI, optMonochrome)
+	if err != nil {
+		t.Fatalf("diffCommand error: %v", err)
+	}
+	if exitCode != exitOK {
+		t.Errorf("diffCommand exit code = %d, want %d", exitCode, exitOK)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("diffCommand output = %q, want nothing", buf.String())
+	}
+}
+
+func TestDiffCommandOptions(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "d1.ini")
+	if err := os.WriteFile(a, []byte("k = 1 ; old note\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	exitCode, err := diffCommand([]string{a, "-"}, strings.NewReader("k = 1 ; new note\n"), &buf, readINI, optMonochrome|optInlineComments)
+	if err != nil {
+		t.Fatalf("diffCommand error: %v", err)
+	}
+	if exitCode != exitOK || buf.Len() != 0 {
+		t.Errorf("diffCommand with --inline-comments = %d, %q, want %d and nothing", exitCode, buf.String(), exitOK)
+	}
+
+	// The reader that --from selects
+	b := filepath.Join(dir, "d1.json")
+	if err := os.WriteFile(b, []byte(`{"k": "1"}`), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	exitCode, err = diffCommand([]string{b, "-"}, strings.NewReader(`{"k": "2"}`), &buf, readJSON, optMonochrome)
+	if err != nil {
+		t.Fatalf("diffCommand error: %v", err)
+	}
+	if want := "~ ini.k = \"1\" -> \"2\";\n"; exitCode != exitDifferent || buf.String() != want {
+		t.Errorf("diffCommand with --from json = %d, %q, want %d and %q", exitCode, buf.String(), exitDifferent, want)
+	}
+}
+
+func TestDiffCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.ini")
+	bad := filepath.Join(dir, "bad.ini")
+	if err := os.WriteFile(good, []byte("key = value\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	if err := os.WriteFile(bad, []byte("[broken\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{good}, exitInvalidOptions},
+		{[]string{"-", "-"}, exitInvalidOptions},
+		{[]string{good, filepath.Join(dir, "missing.ini")}, exitOpenFile},
+		{[]string{bad, good}, exitFormStatements},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		exitCode, err := diffCommand(tt.args, strings.NewReader(""), &buf, readINI, optMonochrome)
+		if err == nil {
+			t.Errorf("diffCommand(%q): expected error, got nil", tt.args)
+		}
+		if exitCode != tt.want {
+			t.Errorf("diffCommand(%q): exit code = %d, want %d", tt.args, exitCode, tt.want)
+		}
+	}
+
+	exitCode, err := diffCommand([]string{good, "-"}, strings.NewReader("key = other\n"), failingWriter{}, readINI, optMonochrome)
+	if err == nil {
+		t.Error("diffCommand to a failing writer: expected error, got nil")
+	}
+	if exitCode != exitReadInput {
+		t.Errorf("diffCommand to a failing writer: exit code = %d, want %d", exitCode, exitReadInput)
+	}
+}
+
+// failingWriter is an io.Writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// dotenvSeparator joins the section names and key of a dotenv variable,
+// as in DATABASE__HOST.
+const dotenvSeparator = "__"
+
+// dotenvEscapes maps the characters that may follow a backslash in a
+// double-quoted dotenv value to the characters they stand for. A
+// backslash before any other character is kept.
+var dotenvEscapes = map[byte]byte{
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+	'"':  '"',
+	'\\': '\\',
+}
+
+// dotenvValueEscaper escapes a value for double quotes in a dotenv file.
+var dotenvValueEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// dotenvReader holds the state of reading a dotenv file.
+type dotenvReader struct {
+	data           iniData
+	pendingComment []string
+	// open is a variable whose quoted value continues on the next line,
+	// and text holds the lines of its value read so far.
+	open *iniKVPair
+	text string
+}
+
+// statementsFromDotenv reads a dotenv file from r and produces grin
+// statements rooted at prefix. Each line sets a variable, KEY=value,
+// optionally preceded by export. A name made up of identifiers joined by
+// double underscores, such as DATABASE__HOST, is the key HOST of the
+// section DATABASE. Values in single quotes are taken as they are, those
+// in double quotes have their escapes decoded and may span lines, and a
+// '#' after whitespace starts a comment after any value. A variable set
+// again replaces its earlier value.
+func statementsFromDotenv(r io.Reader, prefix statement, opts int) (statements, error) {
+	d := &dotenvReader{
+		data: iniData{
+			sectionKeys:     make(map[string][]iniKVPair),
+			sectionComments: make(map[string]string),
+			sectionLines:    make(map[string]int),
+		},
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if lineNum == 1 {
+			line = stripBOM(line)
+		}
+		if err := d.readLine(line, lineNum); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+	if d.open != nil {
+		return nil, fmt.Errorf("line %d: unterminated quoted value", d.open.line)
+	}
+	d.data.trailingComment = strings.Join(d.pendingComment, "\n")
+
+	return buildINIStatements(prefix, &d.data, opts), nil
+}
+
+// readLine reads one line of the file: a comment, a variable, or the
+// continuation of a quoted value.
+func (d *dotenvReader) readLine(line string, lineNum int) error {
+	if d.open != nil {
+		return d.addValue(d.text+"\n"+line, d.open.line)
+	}
+
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case trimmed == "":
+		return nil
+	case trimmed[0] == '#':
+		d.pendingComment = append(d.pendingComment, trimmed)
+		return nil
+	}
+
+	name, text, ok := strings.Cut(trimmed, "=")
+	if !ok {
+		return fmt.Errorf("line %d: expected KEY=value, got %q", lineNum, trimmed)
+	}
+	name = strings.TrimSpace(strings.TrimPrefix(name, "export "))
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("line %d: invalid variable name %q", lineNum, name)
+	}
+
+	comment := strings.Join(d.pendingComment, "\n")
+	d.pendingComment = nil
+	d.open = &iniKVPair{key: name, comment: comment, line: lineNum, delimiter: "="}
+	return d.addValue(strings.TrimLeft(text, " \t"), lineNum)
+}
+
+// addValue parses text as the value of the open variable, recording it
+// unless a quoted string in text continues on the next line.
+func (d *dotenvReader) addValue(text string, lineNum int) error {
+	value, comment, closed, err := parseDotenvValue(text, lineNum)
+	if err != nil || !closed {
+		d.text = text
+		return err
+	}
+	pair := *d.open
+	d.open, d.text = nil, ""
+	pair.value, pair.inlineComment = value, comment
+
+	section, key := dotenvSection(pair.key)
+	if section != "" {
+		d.data.addSection(section, "", pair.line)
+	}
+	pair.key = key
+	d.data.setKey(section, pair)
+	return nil
+}
+
+// parseDotenvValue parses the text after the '=' of a variable, returning
+// its value and any comment after it. closed is false if a quoted value
+// continues on the next line.
+func parseDotenvValue(text string, lineNum int) (value, comment string, closed bool, err error) {
+	if text == "" || (text[0] != '"' && text[0] != '\'') {
+		value, comment = splitDotenvComment(text)
+		return strings.TrimSpace(value), comment, true, nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == text[0]:
+			rest := strings.TrimSpace(text[i+1:])
+			if rest != "" && rest[0] != '#' {
+				return "", "", false, fmt.Errorf("line %d: unexpected %q after quoted value", lineNum, rest)
+			}
+			return b.String(), rest, true, nil
+		case c == '\\' && text[0] == '"' && i+1 < len(text):
+			i++
+			if esc, ok := dotenvEscapes[text[i]]; ok {
+				b.WriteByte(esc)
+			} else {
+				b.WriteByte('\\')
+				b.WriteByte(text[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", false, nil
+}
+
+// splitDotenvComment splits the comment off an unquoted value. A comment
+// starts with a '#' after whitespace.
+func splitDotenvComment(text string) (value, comment string) {
+	for i := 1; i < len(text); i++ {
+		if text[i] == '#' && (text[i-1] == ' ' || text[i-1] == '\t') {
+			return text[:i], strings.TrimSpace(text[i:])
+		}
+	}
+	return text, ""
+}
+
+// dotenvSection splits a variable name made up of identifiers joined by
+// double underscores into its dotted section and the key within it. Any
+// other name has no section.
+func dotenvSection(name string) (section, key string) {
+	parts := strings.Split(name, dotenvSeparator)
+	if len(parts) == 1 {
+		return "", name
+	}
+	for _, p := range parts {
+		if !validIdentifier(p) || strings.HasPrefix(p, "_") || strings.HasSuffix(p, "_") {
+			return "", name
+		}
+	}
+	return strings.Join(parts[:len(parts)-1], "."), parts[len(parts)-1]
+}
+
+// dotenvFromStatements writes statements as a dotenv file. Each key
+// becomes a variable named after its sections and itself, upper-cased
+// and joined by double underscores, as in DATABASE__HOST; characters that
+// can't appear in a variable name become underscores, and a repeated
+// key's index becomes the last part of the name. Values are quoted where
+// needed.
+func dotenvFromStatements(ss statements, w io.Writer) error {
+	return writeVariables(ss, w, dotenvName, func(name, value string) string {
+		return name + "=" + formatDotenvValue(value)
+	}, true)
+}
+
+// writeVariables writes a line for each key of ss, given by line from the
+// key's variable name and value, preceded by its comments. name returns
+// the variable name of a key in a dotted section; two keys with the same
+// one are an error. A key's inline comment is written as a '#' comment
+// after the line if inline is set and it fits on the line, and on a line
+// of its own before the key otherwise.
+func writeVariables(ss statements, w io.Writer, name func(string, ungrinKVPair) string, line func(name, value string) string, inline bool) error {
+	globalKeys, sections, sectionOrder, _ := indexStatements(ss)
+	comments, sectionComments := indexComments(ss)
+	attrs, _ := indexAttributes(ss)
+
+	names := make(map[string]string)
+	write := func(section string, kv ungrinKVPair) error {
+		id := kv.commentKey()
+		n := name(section, kv)
+		if other, seen := names[n]; seen {
+			return fmt.Errorf("keys %q and %q both become %s", other, id, n)
+		}
+		names[n] = id
+
+		if err := writeHashComment(w, "#", comments[id]); err != nil {
+			return err
+		}
+		text := line(n, kv.value)
+		comment := attrs[id]["comment"]
+		if inline && comment != "" && !strings.Contains(comment, "\n") {
+			text += " #" + strings.TrimLeft(comment, ";#")
+		} else if err := writeHashComment(w, "#", comment); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(w, text)
+		return err
+	}
+
+	for _, kv := range globalKeys {
+		if err := write("", kv); err != nil {
+			return err
+		}
+	}
+	for _, secName := range sectionOrder {
+		if err := writeHashComment(w, "#", sectionComments[secName]); err != nil {
+			return err
+		}
+		for _, kv := range sections[secName] {
+			if err := write(secName, kv); err != nil {
+				return err
+			}
+		}
+	}
+	return writeHashComment(w, "#", sectionComments[""])
+}
+
+// dotenvName returns the variable name for kv in the dotted section.
+func dotenvName(section string, kv ungrinKVPair) string {
+	return variableName("", section, kv, dotenvSeparator, unicode.ToUpper)
+}
+
+// variableName returns the name of a variable for kv in the dotted
+// section: prefix, then the section names, the key and any index, joined
+// by sep. ASCII letters after the prefix are passed through fold, and
+// other characters that can't appear in a variable name become
+// underscores.
+func variableName(prefix, section string, kv ungrinKVPair, sep string, fold func(rune) rune) string {
+	var parts []string
+	if section != "" {
+		parts = strings.Split(section, ".")
+	}
+	parts = append(parts, kv.key)
+	if kv.index >= 0 {
+		parts = append(parts, strconv.Itoa(kv.index))
+	}
+
+	name := prefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			return fold(r)
+		case r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, strings.Join(parts, sep))
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// formatDotenvValue quotes value for a dotenv file if it has characters
+// other than letters, digits and common punctuation: in single quotes,
+// which keep it as it is, unless it holds a single quote or a control
+// character, and in double quotes with escapes otherwise.
+func formatDotenvValue(value string) string {
+	if strings.Trim(value, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_-.,:/@%+=") == "" {
+		return value
+	}
+	if !strings.ContainsAny(value, "'\n\r\t") {
+		return "'" + value + "'"
+	}
+	return `"` + dotenvValueEscaper.Replace(value) + `"`
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStatementsFromDotenv(t *testing.T) {
+	input := `# Database
+export DATABASE__HOST=db.example.com
+DATABASE__PORT = 5432 # default
+DATABASE__POOL__SIZE=10
+SECRET='pa$$ "word"'
+GREETING="Hello\n\"World\" \q"
+MULTI="line one
+line two"
+PLAIN=some value  # trailing
+URL=http://x#frag
+A___B=1
+EMPTY=
+PLAIN=again
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromDotenv(strings.NewReader(input), prefix, optComments)
+	if err != nil {
+		t.Fatalf("statementsFromDotenv error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.SECRET = "pa$$ \"word\"";`,
+		`ini.GREETING = "Hello\n\"World\" \\q";`,
+		`ini.MULTI = "line one\nline two";`,
+		`ini.URL = "http://x#frag";`,
+		`ini.A___B = "1";`,
+		`ini.EMPTY = "";`,
+		`ini.PLAIN = "again";`,
+		`ini.DATABASE = {};`,
+		`ini.DATABASE.HOST # "# Database";`,
+		`ini.DATABASE.HOST = "db.example.com";`,
+		`ini.DATABASE.PORT = "5432";`,
+		`ini.DATABASE.PORT@comment = "# default";`,
+		`ini.DATABASE.POOL = {};`,
+		`ini.DATABASE.POOL.SIZE = "10";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestStatementsFromDotenvErrors(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{"missing equals", "KEY\n"},
+		{"empty name", "=value\n"},
+		{"space in name", "MY KEY=value\n"},
+		{"text after quotes", "KEY='a' b\n"},
+		{"unterminated quote", "KEY=\"open\n"},
+	}
+
+	prefix := statement{{text: "ini", typ: typBare}}
+	for _, tt := range tests {
+		if _, err := statementsFromDotenv(strings.NewReader(tt.input), prefix, 0); err == nil {
+			t.Errorf("%s: expected error, got nil", tt.desc)
+		}
+	}
+}
+
+func TestDotenvSection(t *testing.T) {
+	tests := []struct {
+		name         string
+		section, key string
+	}{
+		{"HOST", "", "HOST"},
+		{"DATABASE__HOST", "DATABASE", "HOST"},
+		{"A__B__C", "A.B", "C"},
+		{"A___B", "", "A___B"},
+		{"__A", "", "__A"},
+		{"A__1", "", "A__1"},
+	}
+
+	for _, tt := range tests {
+		section, key := dotenvSection(tt.name)
+		if section != tt.section || key != tt.key {
+			t.Errorf("dotenvSection(%q) = (%q, %q), want (%q, %q)", tt.name, section, key, tt.section, tt.key)
+		}
+	}
+}
+
+func TestDotenvFromStatements(t *testing.T) {
+	input := `ini = {};
+ini.app_name = "SuperApp";
+ini.database # "; connection";
+ini.database = {};
+ini.database.host = "db.example.com";
+ini.database.host@comment = "; primary";
+ini.database.password = "it's $secret";
+ini.database["max-conns"] = "20";
+ini.database.pool = {};
+ini.database.pool.min = "5";
+ini.servers.host[1] = "b";
+ini.servers.host[0] = "a";
+ini.motd = "hello world";
+ini.motd@comment = "# shown at login";
+ini.empty = "";
+ini.banner = "line\n'one'";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := dotenvFromStatements(ss, &buf); err != nil {
+		t.Fatalf("dotenvFromStatements error: %v", err)
+	}
+
+	want := `APP_NAME=SuperApp
+MOTD='hello world' # shown at login
+EMPTY=
+BANNER="line\n'one'"
+# connection
+DATABASE__HOST=db.example.com # primary
+DATABASE__PASSWORD="it's $secret"
+DATABASE__MAX_CONNS=20
+DATABASE__POOL__MIN=5
+SERVERS__HOST__0=a
+SERVERS__HOST__1=b
+`
+	if buf.String() != want {
+		t.Errorf("dotenv output:\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// And back again
+	prefix := statement{{text: "ini", typ: typBare}}
+	again, err := statementsFromDotenv(strings.NewReader(buf.String()), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromDotenv error: %v", err)
+	}
+	values := assignmentValues(again)
+	for path, want := range map[string]string{
+		`ini.MOTD`:               `"hello world"`,
+		`ini.DATABASE.HOST`:      `"db.example.com"`,
+		`ini.BANNER`:             `"line\n'one'"`,
+		`ini.DATABASE.PASSWORD`:  `"it's $secret"`,
+		`ini.DATABASE.MAX_CONNS`: `"20"`,
+	} {
+		if values[path].text != want {
+			t.Errorf("round trip %s = %s, want %s", path, values[path].text, want)
+		}
+	}
+}
+
+func TestDotenvFromStatementsCollision(t *testing.T) {
+	input := `ini.a.b = "1";
+ini["a-b"] = "2";
+ini.a_b = "3";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+	if err := dotenvFromStatements(ss, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for keys with the same variable name, got nil")
+	}
+}
+
+func TestDotenvName(t *testing.T) {
+	tests := []struct {
+		section string
+		kv      ungrinKVPair
+		want    string
+	}{
+		{"", ungrinKVPair{key: "host", index: -1}, "HOST"},
+		{"database.pool", ungrinKVPair{key: "max", index: -1}, "DATABASE__POOL__MAX"},
+		{"http://example.com", ungrinKVPair{key: "x", index: -1}, "HTTP___EXAMPLE__COM__X"},
+		{"", ungrinKVPair{key: "1st", index: -1}, "_1ST"},
+		{"s", ungrinKVPair{key: "k", index: 2}, "S__K__2"},
+	}
+
+	for _, tt := range tests {
+		if got := dotenvName(tt.section, tt.kv); got != tt.want {
+			t.Errorf("dotenvName(%q, %+v) = %q, want %q", tt.section, tt.kv, got, tt.want)
+		}
+	}
+}
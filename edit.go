@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// iniLineKind classifies a physical line of an INI file.
+type iniLineKind int
+
+const (
+	lineOther        iniLineKind = iota // blank line or comment
+	lineSection                         // [section] header
+	lineKey                             // key = value
+	lineContinuation                    // continuation of a multi-line value
+)
+
+// iniLine is one physical line of an INI file, together with what it
+// declares and the section it belongs to. Continuation lines carry the key
+// whose value they continue.
+type iniLine struct {
+	text    string
+	kind    iniLineKind
+	section string
+	key     string
+	// continuation is the style in which the value of a key line is
+	// continued, if it is.
+	continuation string
+	// comment is the inline comment after the value of a key line, as
+	// written and with the space before it.
+	comment string
+}
+
+// iniDocument holds an INI file line by line so that single values can be
+// changed without disturbing comments, ordering or layout elsewhere.
+type iniDocument struct {
+	lines []iniLine
+	eol   string
+	bom   string
+}
+
+// parseINIDocument splits src into classified lines, applying the same
+// syntax rules as statementsFromINI with opts.
+func parseINIDocument(src string, opts int) (*iniDocument, error) {
+	d := &iniDocument{eol: "\n"}
+	if stripped := stripBOM(src); stripped != src {
+		d.bom = src[:len(src)-len(stripped)]
+		src = stripped
+	}
+	if strings.Contains(src, "\r\n") {
+		d.eol = "\r\n"
+	}
+
+	src = strings.TrimSuffix(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	if src == "" {
+		return d, nil
+	}
+
+	var (
+		currentSection string
+		open           *openValue
+		keyAt          int
+	)
+	for i, text := range strings.Split(src, "\n") {
+		line := iniLine{text: text, section: currentSection}
+		trimmed := strings.TrimSpace(text)
+
+		switch {
+		case open.add(text):
+			d.continueValue(keyAt, &line, open)
+		case trimmed == "":
+			line.kind = lineOther
+		case trimmed[0] == ';' || trimmed[0] == '#':
+			line.kind = lineOther
+		case trimmed[0] == '[':
+			open = nil
+			name, err := parseSectionHeader(trimmed, i+1)
+			if err != nil {
+				return nil, err
+			}
+			currentSection = name
+			line.kind = lineSection
+			line.section = name
+		default:
+			pair, err := parseINIKeyValue(trimmed, i+1, opts)
+			if err != nil {
+				return nil, err
+			}
+			open = newOpenValue(currentSection, pair, text, opts)
+			keyAt = len(d.lines)
+			line.kind = lineKey
+			line.key = pair.key
+			line.continuation = open.pair.continuation
+			if pair.inlineComment != "" {
+				line.comment = inlineCommentText(text)
+			}
+		}
+		d.lines = append(d.lines, line)
+	}
+	return d, nil
+}
+
+// continueValue classifies line, which open has taken, as continuing the
+// value of the key on line keyAt. A blank line is left as it is until a
+// continuation line follows it, which takes in the blank lines before it.
+func (d *iniDocument) continueValue(keyAt int, line *iniLine, open *openValue) {
+	if strings.TrimSpace(line.text) == "" {
+		line.kind = lineOther
+		return
+	}
+	for i := len(d.lines) - 1; i > keyAt && strings.TrimSpace(d.lines[i].text) == ""; i-- {
+		d.lines[i].kind = lineContinuation
+		d.lines[i].key = open.pair.key
+	}
+	line.kind = lineContinuation
+	line.key = open.pair.key
+	d.lines[keyAt].continuation = open.pair.continuation
+}
+
+// String renders the document with its original BOM and line endings.
+func (d *iniDocument) String() string {
+	var b strings.Builder
+	b.WriteString(d.bom)
+	for _, l := range d.lines {
+		b.WriteString(l.text)
+		b.WriteString(d.eol)
+	}
+	return b.String()
+}
+
+// keyLines returns the line numbers of every occurrence of key in section.
+func (d *iniDocument) keyLines(section, key string) []int {
+	var found []int
+	for i, l := range d.lines {
+		if l.kind == lineKey && l.section == section && l.key == key {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+// keyLine returns the line number of the index-th occurrence of key in
+// section, treating an index of -1 as the only occurrence, or -1 if there
+// is no such line.
+func (d *iniDocument) keyLine(section, key string, index int) int {
+	found := d.keyLines(section, key)
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(found) {
+		return -1
+	}
+	return found[index]
+}
+
+// valueEnd returns the line number after the last line of the value of
+// the key on line at.
+func (d *iniDocument) valueEnd(at int) int {
+	end := at + 1
+	for end < len(d.lines) && d.lines[end].kind == lineContinuation {
+		end++
+	}
+	return end
+}
+
+// removeKey deletes the lines holding key in section, if there are any.
+func (d *iniDocument) removeKey(section, key string, index int) {
+	if at := d.keyLine(section, key, index); at >= 0 {
+		d.lines = append(d.lines[:at], d.lines[d.valueEnd(at):]...)
+	}
+}
+
+// removeSection deletes the header of section name, and the comments and
+// blank lines that follow it, provided the section no longer has any keys.
+func (d *iniDocument) removeSection(name string) {
+	for _, l := range d.lines {
+		if l.section == name && l.kind == lineKey {
+			return
+		}
+	}
+
+	kept := d.lines[:0]
+	for _, l := range d.lines {
+		if l.section != name {
+			kept = append(kept, l)
+		}
+	}
+	d.lines = kept
+}
+
+// set changes the value of key in section, or of its index-th occurrence
+// when index is not -1. Missing keys are added at the end of their section
+// and missing sections at the end of the document.
+func (d *iniDocument) set(section, key string, index int, value string) error {
+	found := d.keyLines(section, key)
+
+	switch {
+	case index < 0 && len(found) > 1:
+		return fmt.Errorf("key %q occurs %d times; give an index to choose one", key, len(found))
+	case index < 0 && len(found) == 1:
+		d.replaceValue(found[0], value)
+	case index >= 0 && index < len(found):
+		d.replaceValue(found[index], value)
+	case index > len(found):
+		return fmt.Errorf("index %d of key %q is out of range (%d occurrences)", index, key, len(found))
+	default:
+		if err := checkINIKey(key); err != nil {
+			return err
+		}
+		d.insertKey(section, key, value)
+	}
+	return nil
+}
+
+// setValues gives key in section one occurrence for each of values: it
+// replaces the values of the occurrences it has in order, deletes those
+// left over and adds the rest after the last one, or as with insertKey if
+// there are none.
+func (d *iniDocument) setValues(section, key string, values []string) {
+	found := d.keyLines(section, key)
+	// Work backwards so that earlier line numbers stay put
+	for i := len(found) - 1; i >= len(values); i-- {
+		d.lines = append(d.lines[:found[i]], d.lines[d.valueEnd(found[i]):]...)
+	}
+	for i := min(len(found), len(values)) - 1; i >= 0; i-- {
+		d.replaceValue(found[i], values[i])
+	}
+	if len(values) <= len(found) {
+		return
+	}
+
+	if len(found) == 0 {
+		for _, value := range values {
+			d.insertKey(section, key, value)
+		}
+		return
+	}
+	last := d.keyLine(section, key, len(found)-1)
+	var lines []iniLine
+	for _, value := range values[len(found):] {
+		// The comment belongs to the occurrence it was written after
+		lines = append(lines, keyValueLines(withoutComment(d.lines[last]), value)...)
+	}
+	d.insertLines(d.valueEnd(last), lines...)
+}
+
+// replaceValue replaces the value of the key on line at, together with
+// any continuation lines, by value.
+func (d *iniDocument) replaceValue(at int, value string) {
+	lines := keyValueLines(d.lines[at], value)
+	d.lines = append(d.lines[:at], append(lines, d.lines[d.valueEnd(at):]...)...)
+}
+
+// keyValueLines returns the lines that give the key on line l the value
+// value, continuing a multi-line value in the style l already uses and
+// indented deeper than the key. An inline comment on l is kept after the
+// new value.
+func keyValueLines(l iniLine, value string) []iniLine {
+	comment := l.comment
+	l = withoutComment(l)
+	first, rest := continuationLines(value, l.continuation)
+	l.text = replaceINIValue(l.text, first)
+	if first == "" && len(rest) > 0 {
+		// The value starts on the next line
+		l.text = strings.TrimRight(l.text, " \t")
+	}
+	if comment != "" {
+		l.text, l.comment = insertComment(l.text, comment, l.continuation == contBackslash && len(rest) > 0), comment
+	}
+	lines := []iniLine{l}
+
+	indent := l.text[:indentWidth(l.text)]
+	for _, text := range rest {
+		lines = append(lines, iniLine{text: indent + text, kind: lineContinuation, section: l.section, key: l.key})
+	}
+	return lines
+}
+
+// inlineCommentText returns the inline comment at the end of the key line
+// text, with the space before it and without a backslash that continues
+// the value after it.
+func inlineCommentText(text string) string {
+	rest := text[delimiterIndex(text)+1:]
+	value, _ := splitInlineComment(rest)
+	comment := rest[len(strings.TrimRight(value, " \t")):]
+	comment, _ = trimContinuation(strings.TrimRight(comment, " \t"))
+	return comment
+}
+
+// withoutComment returns the key line l with its inline comment, and
+// anything written after it, removed.
+func withoutComment(l iniLine) iniLine {
+	if l.comment != "" {
+		l.text = strings.TrimRight(l.text[:strings.LastIndex(l.text, l.comment)], " \t")
+		l.comment = ""
+	}
+	return l
+}
+
+// insertComment appends comment to the key line text, before the
+// backslash that ends it when continued is set.
+func insertComment(text, comment string, continued bool) string {
+	if !continued {
+		return text + comment
+	}
+	text, _ = trimContinuation(text)
+	return text + comment + " \\"
+}
+
+// insertKey adds a new key after the last key of section, after its
+// header if it has no keys yet, or in a new section at the end.
+func (d *iniDocument) insertKey(section, key, value string) {
+	newLines := keyValueLines(iniLine{text: key + " =", kind: lineKey, section: section, key: key}, value)
+
+	at := -1
+	for i, l := range d.lines {
+		if l.section != section {
+			continue
+		}
+		if l.kind == lineKey || l.kind == lineContinuation || (l.kind == lineSection && at == -1) {
+			at = i
+		}
+	}
+
+	switch {
+	case at >= 0:
+		d.insertLines(at+1, newLines...)
+	case section == "":
+		// No global keys yet: they must come before the first header
+		d.insertLines(0, newLines...)
+	default:
+		d.appendSection(section)
+		d.lines = append(d.lines, newLines...)
+	}
+}
+
+// hasSection reports whether the document declares section name, or a
+// section nested below it.
+func (d *iniDocument) hasSection(name string) bool {
+	for _, l := range d.lines {
+		if l.kind == lineSection && (l.section == name || strings.HasPrefix(l.section, name+".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendSection adds an empty section header at the end of the document.
+func (d *iniDocument) appendSection(name string) {
+	if len(d.lines) > 0 && strings.TrimSpace(d.lines[len(d.lines)-1].text) != "" {
+		d.lines = append(d.lines, iniLine{section: d.lines[len(d.lines)-1].section})
+	}
+	d.lines = append(d.lines, iniLine{text: "[" + name + "]", kind: lineSection, section: name})
+}
+
+// insertLines inserts lines before position at.
+func (d *iniDocument) insertLines(at int, lines ...iniLine) {
+	d.lines = append(d.lines[:at], append(lines, d.lines[at:]...)...)
+}
+
+// replaceINIValue swaps the value on a key line for value, keeping the
+// key, the spacing around the delimiter and any surrounding quotes.
+func replaceINIValue(line, value string) string {
+	eqIdx := delimiterIndex(line)
+	rest := line[eqIdx+1:]
+	old := strings.TrimSpace(rest)
+	space := rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+	if old == "" && space == "" && strings.HasSuffix(line[:eqIdx], " ") {
+		space = " "
+	}
+
+	if stripINIQuotes(old) != old {
+		q := old[:1]
+		return line[:eqIdx+1] + space + q + value + q
+	}
+	return line[:eqIdx+1] + space + formatINIValue(value)
+}
+
+// formatINIValue quotes value if it would otherwise lose surrounding
+// whitespace or quotes when read back.
+func formatINIValue(value string) string {
+	if strings.TrimSpace(value) != value || stripINIQuotes(value) != value {
+		return `"` + value + `"`
+	}
+	return value
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseINIDocumentPreservesLayout(t *testing.T) {
+	tests := []string{
+		"",
+		"; comment only\n",
+		"key=value\n\n[section]\n  indented = yes   \n# note\n",
+		"\xEF\xBB\xBF[section]\r\nkey = value\r\n",
+		"[options]\nrequires =\n    requests\n    click\npath = /a \\\n/b\n",
+	}
+
+	for _, input := range tests {
+		d, err := parseINIDocument(input, optBackslashContinuations)
+		if err != nil {
+			t.Fatalf("parseINIDocument(%q) error: %v", input, err)
+		}
+		if got := d.String(); got != input {
+			t.Errorf("parseINIDocument(%q).String() = %q", input, got)
+		}
+	}
+}
+
+func TestParseINIDocumentErrors(t *testing.T) {
+	tests := []string{
+		"[unclosed\n",
+		"[section]\nnotakeyvalue\n",
+	}
+
+	for _, input := range tests {
+		if _, err := parseINIDocument(input, 0); err == nil {
+			t.Errorf("parseINIDocument(%q): expected error, got nil", input)
+		}
+	}
+}
+
+func TestINIDocumentSet(t *testing.T) {
+	input := `; Settings
+name = app
+
+[database]
+host = localhost ; primary
+port=5432
+user = "admin"
+
+[php]
+extension = curl
+extension = gd
+`
+	tests := []struct {
+		desc    string
+		section string
+		key     string
+		index   int
+		value   string
+		want    string
+	}{
+		{"replace keeps spacing", "database", "port", -1, "5433", "; Settings\nname = app\n\n[database]\nhost = localhost ; primary\nport=5433\nuser = \"admin\"\n\n[php]\nextension = curl\nextension = gd\n"},
+		{"replace keeps quotes", "database", "user", -1, "root", "; Settings\nname = app\n\n[database]\nhost = localhost ; primary\nport=5432\nuser = \"root\"\n\n[php]\nextension = curl\nextension = gd\n"},
+		{"replace global", "", "name", -1, "other", "; Settings\nname = other\n\n[database]\nhost = localhost ; primary\nport=5432\nuser = \"admin\"\n\n[php]\nextension = curl\nextension = gd\n"},
+		{"add to section", "database", "pool", -1, "10", "; Settings\nname = app\n\n[database]\nhost = localhost ; primary\nport=5432\nuser = \"admin\"\npool = 10\n\n[php]\nextension = curl\nextension = gd\n"},
+		{"add global", "", "debug", -1, "true", "; Settings\nname = app\ndebug = true\n\n[database]\nhost = localhost ; primary\nport=5432\nuser = \"admin\"\n\n[php]\nextension = curl\nextension = gd\n"},
+		{"add section", "cache", "ttl", -1, "60", "; Settings\nname = app\n\n[database]\nhost = localhost ; primary\nport=5432\nuser = \"admin\"\n\n[php]\nextension = curl\nextension = gd\n\n[cache]\nttl = 60\n"},
+		{"replace indexed", "php", "extension", 1, "mbstring", "; Settings\nname = app\n\n[database]\nhost = localhost ; primary\nport=5432\nuser = \"admin\"\n\n[php]\nextension = curl\nextension = mbstring\n"},
+		{"append indexed", "php", "extension", 2, "intl", "; Settings\nname = app\n\n[database]\nhost = localhost ; primary\nport=5432\nuser = \"admin\"\n\n[php]\nextension = curl\nextension = gd\nextension = intl\n"},
+		{"quote padded value", "database", "port", -1, " 1 ", "; Settings\nname = app\n\n[database]\nhost = localhost ; primary\nport=\" 1 \"\nuser = \"admin\"\n\n[php]\nextension = curl\nextension = gd\n"},
+	}
+
+	for _, tt := range tests {
+		d, err := parseINIDocument(input, 0)
+		if err != nil {
+			t.Fatalf("parseINIDocument error: %v", err)
+		}
+		if err := d.set(tt.section, tt.key, tt.index, tt.value); err != nil {
+			t.Errorf("%s: set error: %v", tt.desc, err)
+			continue
+		}
+		if got := d.String(); got != tt.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestINIDocumentSetErrors(t *testing.T) {
+	input := "[php]\nextension = curl\nextension = gd\n"
+
+	tests := []struct {
+		desc  string
+		index int
+	}{
+		{"ambiguous repeated key", -1},
+		{"index out of range", 3},
+	}
+
+	for _, tt := range tests {
+		d, err := parseINIDocument(input, 0)
+		if err != nil {
+			t.Fatalf("parseINIDocument error: %v", err)
+		}
+		if err := d.set("php", "extension", tt.index, "x"); err == nil {
+			t.Errorf("%s: expected error, got nil", tt.desc)
+		}
+	}
+}
+
+func TestINIDocumentRemove(t *testing.T) {
+	input := "[a]\nx = 1\ny = 2\n\n[b]\n; about b\nz = 3\n\n[c]\nw = 4\n"
+	d, err := parseINIDocument(input, 0)
+	if err != nil {
+		t.Fatalf("parseINIDocument error: %v", err)
+	}
+
+	d.removeKey("a", "x", -1)
+	d.removeKey("a", "missing", -1)
+	d.removeSection("a") // still has y
+	d.removeKey("b", "z", -1)
+	d.removeSection("b")
+
+	want := "[a]\ny = 2\n\n[c]\nw = 4\n"
+	if got := d.String(); got != want {
+		t.Errorf("after removals = %q, want %q", got, want)
+	}
+}
+
+func TestINIDocumentSetValues(t *testing.T) {
+	input := "[a]\nx = 1\ny = 2\nx = 3\n"
+	tests := []struct {
+		key    string
+		values []string
+		want   string
+	}{
+		{"x", []string{"1", "4"}, "[a]\nx = 1\ny = 2\nx = 4\n"},
+		{"x", []string{"5"}, "[a]\nx = 5\ny = 2\n"},
+		{"x", nil, "[a]\ny = 2\n"},
+		{"y", []string{"2", "6", "7"}, "[a]\nx = 1\ny = 2\ny = 6\ny = 7\nx = 3\n"},
+		{"z", []string{"8", "9"}, "[a]\nx = 1\ny = 2\nx = 3\nz = 8\nz = 9\n"},
+	}
+
+	for _, tt := range tests {
+		d, err := parseINIDocument(input, 0)
+		if err != nil {
+			t.Fatalf("parseINIDocument error: %v", err)
+		}
+		d.setValues("a", tt.key, tt.values)
+		if got := d.String(); got != tt.want {
+			t.Errorf("setValues(%q, %q) = %q, want %q", tt.key, tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestINIDocumentContinuations(t *testing.T) {
+	input := "[a]\nlist =\n    x\n    y\nother = 1\npath = /a \\\n/b\n"
+
+	tests := []struct {
+		desc string
+		edit func(d *iniDocument) error
+		want string
+	}{
+		{"replace multi-line", func(d *iniDocument) error { return d.set("a", "list", -1, "\nz") },
+			"[a]\nlist =\n    z\nother = 1\npath = /a \\\n/b\n"},
+		{"replace with one line", func(d *iniDocument) error { return d.set("a", "list", -1, "z") },
+			"[a]\nlist = z\nother = 1\npath = /a \\\n/b\n"},
+		{"keep backslashes and indent", func(d *iniDocument) error { return d.set("a", "path", -1, "/c\n/d\n/e") },
+			"[a]\nlist =\n    x\n    y\nother = 1\npath = /c \\\n    /d \\\n    /e\n"},
+		{"add multi-line", func(d *iniDocument) error { return d.set("a", "new", -1, "p\nq") },
+			"[a]\nlist =\n    x\n    y\nother = 1\npath = /a \\\n/b\nnew = p\n    q\n"},
+		{"remove", func(d *iniDocument) error { d.removeKey("a", "list", -1); return nil },
+			"[a]\nother = 1\npath = /a \\\n/b\n"},
+	}
+
+	for _, tt := range tests {
+		d, err := parseINIDocument(input, optBackslashContinuations)
+		if err != nil {
+			t.Fatalf("parseINIDocument error: %v", err)
+		}
+		if err := tt.edit(d); err != nil {
+			t.Errorf("%s: error: %v", tt.desc, err)
+			continue
+		}
+		if got := d.String(); got != tt.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestINIDocumentBlankLinesInValue(t *testing.T) {
+	d, err := parseINIDocument("[a]\ndeps = a\n  b\n\n  c\n\nother = 1\n", 0)
+	if err != nil {
+		t.Fatalf("parseINIDocument error: %v", err)
+	}
+	if err := d.set("a", "deps", -1, "d"); err != nil {
+		t.Fatalf("set error: %v", err)
+	}
+	if want := "[a]\ndeps = d\n\nother = 1\n"; d.String() != want {
+		t.Errorf("set:\ngot:\n%s\nwant:\n%s", d.String(), want)
+	}
+}
+
+func TestINIDocumentInlineComments(t *testing.T) {
+	input := "[db]\nport = 5432 ; default\nhost = \"a b\"  # primary\npath = /a ; first \\\n/b\n"
+
+	tests := []struct {
+		desc string
+		edit func(d *iniDocument) error
+		want string
+	}{
+		{"keep comment", func(d *iniDocument) error { return d.set("db", "port", -1, "6543") },
+			"[db]\nport = 6543 ; default\nhost = \"a b\"  # primary\npath = /a ; first \\\n/b\n"},
+		{"keep comment after quotes", func(d *iniDocument) error { return d.set("db", "host", -1, "c") },
+			"[db]\nport = 5432 ; default\nhost = \"c\"  # primary\npath = /a ; first \\\n/b\n"},
+		{"keep comment before backslash", func(d *iniDocument) error { return d.set("db", "path", -1, "/c\n/d") },
+			"[db]\nport = 5432 ; default\nhost = \"a b\"  # primary\npath = /c ; first \\\n    /d\n"},
+		{"added values have none", func(d *iniDocument) error { d.setValues("db", "port", []string{"1", "2"}); return nil },
+			"[db]\nport = 1 ; default\nport = 2\nhost = \"a b\"  # primary\npath = /a ; first \\\n/b\n"},
+	}
+
+	for _, tt := range tests {
+		d, err := parseINIDocument(input, optInlineComments|optBackslashContinuations)
+		if err != nil {
+			t.Fatalf("parseINIDocument error: %v", err)
+		}
+		if err := tt.edit(d); err != nil {
+			t.Errorf("%s: error: %v", tt.desc, err)
+			continue
+		}
+		if got := d.String(); got != tt.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestReplaceINIValue(t *testing.T) {
+	tests := []struct {
+		line  string
+		value string
+		want  string
+	}{
+		{"key = old", "new", "key = new"},
+		{"key=old", "new", "key=new"},
+		{"  key  =   old", "new", "  key  =   new"},
+		{"key = 'old'", "new", "key = 'new'"},
+		{"key =", "new", "key = new"},
+		{"key=", "new", "key=new"},
+		{"url = a=b", "c=d", "url = c=d"},
+		{"name: old", "new", "name: new"},
+		{"url = http://a", "http://b", "url = http://b"},
+	}
+
+	for _, tt := range tests {
+		if got := replaceINIValue(tt.line, tt.value); got != tt.want {
+			t.Errorf("replaceINIValue(%q, %q) = %q, want %q", tt.line, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultIncludes are the file name patterns that --recursive picks up
+// when no --include is given.
+var defaultIncludes = []string{"*.ini", "*.conf", "*.cfg"}
+
+// patternList collects the values of a repeatable flag such as --include.
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(value string) error {
+	if _, err := filepath.Match(value, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q", value)
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+// namedInput is one input file together with the name it was given on the
+// command line ("-" for stdin). Files found by --recursive are named by
+// their path relative to the directory searched, and are only opened when
+// they are read.
+type namedInput struct {
+	name string
+	path string
+	r    io.Reader
+}
+
+// skippedFilesError reports that some of the inputs found by --recursive
+// could not be read. Their errors have already been reported as warnings,
+// and the statements of the other files are still written.
+type skippedFilesError struct {
+	count int
+}
+
+func (e *skippedFilesError) Error() string {
+	if e.count == 1 {
+		return "1 file could not be read"
+	}
+	return fmt.Sprintf("%d files could not be read", e.count)
+}
+
+// collectInputs returns the inputs named by args: the files themselves (or
+// stdin), or with optRecursive the matching files below each directory.
+// Problems met while searching directories are reported to warn.
+func collectInputs(args, patterns []string, stdin io.Reader, warn io.Writer, opts int) ([]namedInput, error) {
+	if opts&optRecursive == 0 {
+		return openInputs(args, stdin)
+	}
+	if len(patterns) == 0 {
+		patterns = defaultIncludes
+	}
+	return walkInputs(args, patterns, warn)
+}
+
+// openInputs opens every named file, reading stdin for "-" or when no
+// files are named at all. On failure the files opened so far are closed.
+func openInputs(names []string, stdin io.Reader) ([]namedInput, error) {
+	if len(names) == 0 {
+		return []namedInput{{name: "-", r: stdin}}, nil
+	}
+
+	inputs := make([]namedInput, 0, len(names))
+	for _, name := range names {
+		if name == "-" {
+			inputs = append(inputs, namedInput{name: name, r: stdin})
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			closeInputs(inputs)
+			return nil, err
+		}
+		inputs = append(inputs, namedInput{name: name, r: f})
+	}
+	return inputs, nil
+}
+
+// walkInputs finds the files below each of roots (the current directory
+// if there are none) whose names match one of patterns, in lexical order.
+// Roots that are files are used as they are. Directories that can't be
+// read are reported to warn and skipped.
+func walkInputs(roots, patterns []string, warn io.Writer) ([]namedInput, error) {
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	var inputs []namedInput
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			inputs = append(inputs, namedInput{name: root, path: root})
+			continue
+		}
+
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				fmt.Fprintf(warn, "grin: %s\n", err)
+				return nil
+			}
+			if d.IsDir() || !matchesAny(d.Name(), patterns) {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			inputs = append(inputs, namedInput{name: filepath.ToSlash(rel), path: path})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no files matching %s in %s", strings.Join(patterns, ", "), strings.Join(roots, ", "))
+	}
+	return inputs, nil
+}
+
+// matchesAny reports whether name matches one of patterns.
+func matchesAny(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// closeInputs closes the inputs that are open files.
+func closeInputs(inputs []namedInput) {
+	for _, in := range inputs {
+		if c, ok := in.r.(io.Closer); ok && in.name != "-" {
+			c.Close() //nolint:errcheck // best-effort close on read-only file
+		}
+	}
+}
+
+// readInput reads one input with read, opening it first if it was found by
+// --recursive, and names it in any error and in the source positions of
+// its statements.
+func readInput(read readerFn, in namedInput, opts int) (statements, error) {
+	r := in.r
+	if r == nil {
+		f, err := os.Open(in.path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close() //nolint:errcheck // best-effort close on read-only file
+		r = f
+	}
+
+	ss, err := read(r, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", in.name, err)
+	}
+	if in.name != "-" {
+		locatePositions(ss, in.name)
+	}
+	return ss, nil
+}
+
+// readFiles returns a reader that reads each of inputs in turn with read,
+// in place of the input it is given. If qualify is set, the statements of
+// each file are rooted at ini["name"], and a stream written by --ungrin -H
+// is read as the files it holds; otherwise they are concatenated, as
+// suits grin input that carries its own paths. If warn is not nil, a file
+// that can't be read is reported to it and skipped rather than ending the
+// read, which then fails with a *skippedFilesError.
+func readFiles(read readerFn, inputs []namedInput, qualify bool, warn io.Writer) readerFn {
+	return func(_ io.Reader, opts int) (statements, error) {
+		var ss statements
+		if qualify {
+			ss = statements{statement{{text: "ini", typ: typBare}}.withEmptyObject()}
+		}
+
+		files := inputs
+		if qualify {
+			var err error
+			if files, err = splitInputs(inputs); err != nil {
+				return nil, err
+			}
+		}
+
+		skipped := 0
+		for _, in := range files {
+			fs, err := readInput(read, in, opts)
+			if err != nil {
+				if warn == nil {
+					return nil, err
+				}
+				fmt.Fprintf(warn, "grin: %s\n", err)
+				skipped++
+				continue
+			}
+			if qualify {
+				fs = qualifyStatements(fs, in.name)
+			}
+			ss = append(ss, fs...)
+		}
+
+		if skipped > 0 {
+			return ss, &skippedFilesError{count: skipped}
+		}
+		return ss, nil
+	}
+}
+
+// splitInputs replaces each of the inputs given on the command line that
+// is a stream written by --ungrin -H with the files it holds, so that -H
+// reads the stream back as the files it was written from. Files found by
+// --recursive are taken as they are.
+func splitInputs(inputs []namedInput) ([]namedInput, error) {
+	var split []namedInput
+	for _, in := range inputs {
+		if in.r == nil {
+			split = append(split, in)
+			continue
+		}
+		src, err := io.ReadAll(in.r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", in.name, err)
+		}
+		if files, ok := splitFileHeaders(string(src)); ok {
+			split = append(split, files...)
+			continue
+		}
+		in.r = strings.NewReader(string(src))
+		split = append(split, in)
+	}
+	return split, nil
+}
+
+// inputsReader adapts read, which reads the format inFmt, to the given
+// inputs. Several INI or JSON files are read as one document, each rooted
+// at its filename (which --with-filename and --recursive also ask for with
+// a single file); several grin files are concatenated. With --recursive,
+// files that can't be read are reported to warn and skipped. With --merge,
+// the inputs are instead layered into one configuration, by the rules of
+// inFmt if it has its own.
+// It returns the options with optWithFilename set if filenames are in use.
+func inputsReader(read readerFn, inputs []namedInput, inFmt string, opts int, warn io.Writer) (readerFn, int) {
+	if opts&optMerge > 0 {
+		layers := readLayers
+		if lr, ok := layerReaders[inFmt]; ok {
+			layers = lr
+		}
+		return layers(read, inputs), opts &^ optWithFilename
+	}
+	if opts&optRecursive == 0 {
+		warn = nil
+	}
+
+	if inFmt == "grin" {
+		if len(inputs) > 1 || warn != nil {
+			read = readFiles(read, inputs, false, warn)
+		}
+		return read, opts
+	}
+
+	if len(inputs) > 1 || warn != nil {
+		opts |= optWithFilename
+	}
+	switch {
+	case opts&optWithFilename > 0:
+		read = readFiles(read, inputs, true, warn)
+	case opts&optLineNumbers > 0:
+		// A single file, read by name so that positions can name it
+		read = readFiles(read, inputs, false, nil)
+	}
+	return read, opts
+}
+
+// isSkipped reports whether err only records files skipped by --recursive,
+// so that the statements read from the other files can still be written.
+func isSkipped(err error) bool {
+	var skipped *skippedFilesError
+	return errors.As(err, &skipped)
+}
+
+// qualifyStatements inserts filename as the first path component of every
+// statement, so that `ini.section.key` becomes `ini["a.ini"].section.key`.
+func qualifyStatements(ss statements, filename string) statements {
+	qualified := make(statements, len(ss))
+	for i, s := range ss {
+		if len(s) == 0 {
+			qualified[i] = s
+			continue
+		}
+		root := statement{s[0]}.withKey(filename)
+		qualified[i] = append(root, s[1:]...)
+	}
+	return qualified
+}
+
+// splitFileStatement is the reverse of qualifyStatements: it returns the
+// filename component of s and s with that component removed. ok is false
+// if s has no component below the root.
+func splitFileStatement(s statement) (filename string, rest statement, ok bool) {
+	if len(s) < 3 {
+		return "", nil, false
+	}
+	switch {
+	case s[1].typ == typDot && s[2].typ == typBare:
+		filename, rest = s[2].text, append(statement{s[0]}, s[3:]...)
+	case len(s) >= 4 && s[1].typ == typLBrace && s[2].typ == typQuotedKey && s[3].typ == typRBrace:
+		filename, rest = unquoteString(s[2].text), append(statement{s[0]}, s[4:]...)
+	default:
+		return "", nil, false
+	}
+	return filename, rest, true
+}
+
+// splitFileHeaders splits src into the files of a stream written by
+// --ungrin -H or head(1), each preceded by a ==> FILE <== header. ok is
+// false if src doesn't start with such a header.
+func splitFileHeaders(src string) (inputs []namedInput, ok bool) {
+	var text strings.Builder
+	for _, line := range strings.SplitAfter(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+		name, isHeader := strings.CutPrefix(trimmed, "==> ")
+		if isHeader {
+			name, isHeader = strings.CutSuffix(name, " <==")
+		}
+		switch {
+		case isHeader:
+			if len(inputs) > 0 {
+				inputs[len(inputs)-1].r = strings.NewReader(text.String())
+			}
+			inputs = append(inputs, namedInput{name: name})
+			text.Reset()
+		case len(inputs) == 0 && trimmed != "":
+			return nil, false
+		default:
+			text.WriteString(line)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, false
+	}
+	inputs[len(inputs)-1].r = strings.NewReader(text.String())
+	return inputs, true
+}
+
+// ungrinFiles writes the INI for each file in statements qualified by
+// qualifyStatements, in order of appearance, each preceded by a header
+// naming the file in the style of head(1), which readINI reads back.
+func ungrinFiles(ss statements, w io.Writer) error {
+	var names []string
+	files := make(map[string]statements)
+	for _, s := range ss {
+		name, rest, ok := splitFileStatement(s)
+		if !ok {
+			continue
+		}
+		if _, seen := files[name]; !seen {
+			names = append(names, name)
+		}
+		files[name] = append(files[name], rest)
+	}
+
+	for i, name := range names {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "==> %s <==\n", name); err != nil {
+			return err
+		}
+		if err := ungrinFromStatements(files[name], w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestQualifyStatements(t *testing.T) {
+	ss, err := readINI(strings.NewReader("name = app\n[database]\nhost = localhost\n"), 0)
+	if err != nil {
+		t.Fatalf("readINI error: %v", err)
+	}
+
+	var got []string
+	for _, s := range qualifyStatements(ss, "conf.d/db.ini") {
+		got = append(got, statementToString(s))
+	}
+	want := []string{
+		`ini["conf.d/db.ini"] = {};`,
+		`ini["conf.d/db.ini"].name = "app";`,
+		`ini["conf.d/db.ini"].database = {};`,
+		`ini["conf.d/db.ini"].database.host = "localhost";`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("qualifyStatements:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSplitFileStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		filename string
+		rest     string
+	}{
+		{`ini["conf.d/db.ini"].database.host = "localhost";`, "conf.d/db.ini", `ini.database.host = "localhost";`},
+		{`ini["a.ini"] = {};`, "a.ini", `ini = {};`},
+		{`ini.config.key = "v";`, "config", `ini.key = "v";`},
+	}
+
+	for _, tt := range tests {
+		ss, err := ungrinStatements(strings.NewReader(tt.input))
+		if err != nil {
+			t.Fatalf("ungrinStatements(%q) error: %v", tt.input, err)
+		}
+		filename, rest, ok := splitFileStatement(ss[0])
+		if !ok {
+			t.Errorf("splitFileStatement(%q): expected ok", tt.input)
+			continue
+		}
+		if filename != tt.filename || statementToString(rest) != tt.rest {
+			t.Errorf("splitFileStatement(%q) = (%q, %q), want (%q, %q)",
+				tt.input, filename, statementToString(rest), tt.filename, tt.rest)
+		}
+	}
+
+	ss, err := ungrinStatements(strings.NewReader("ini = {};"))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+	if _, _, ok := splitFileStatement(ss[0]); ok {
+		t.Error("splitFileStatement(root): expected not ok")
+	}
+}
+
+func TestReadFilesRoundTrip(t *testing.T) {
+	inputs := []namedInput{
+		{name: "a.ini", r: strings.NewReader("[app]\nname = one\n")},
+		{name: "b.ini", r: strings.NewReader("top = 1\n\n[app]\nname = two\n")},
+	}
+	read, opts := inputsReader(readINI, inputs, "ini", optMonochrome, nil)
+	if opts&optWithFilename == 0 {
+		t.Error("inputsReader: expected optWithFilename for several files")
+	}
+
+	var buf bytes.Buffer
+	exitCode, err := formatAction(read, writeGrin, exitFormStatements)(nil, &buf, opts)
+	if err != nil {
+		t.Fatalf("action error: %v", err)
+	}
+	if exitCode != exitOK {
+		t.Fatalf("action exit code: %d", exitCode)
+	}
+
+	wantGrin := `ini = {};
+ini["a.ini"] = {};
+ini["a.ini"].app = {};
+ini["a.ini"].app.name = "one";
+ini["b.ini"] = {};
+ini["b.ini"].app = {};
+ini["b.ini"].app.name = "two";
+ini["b.ini"].top = "1";
+`
+	if buf.String() != wantGrin {
+		t.Errorf("grin output:\n%s\nwant:\n%s", buf.String(), wantGrin)
+	}
+
+	var out bytes.Buffer
+	exitCode, err = ungrinAction(strings.NewReader(buf.String()), &out, optMonochrome|optWithFilename)
+	if err != nil {
+		t.Fatalf("ungrinAction error: %v", err)
+	}
+	if exitCode != exitOK {
+		t.Fatalf("ungrinAction exit code: %d", exitCode)
+	}
+
+	wantINI := "==> a.ini <==\n[app]\nname = one\n\n==> b.ini <==\ntop = 1\n\n[app]\nname = two\n"
+	if out.String() != wantINI {
+		t.Errorf("ungrin output = %q, want %q", out.String(), wantINI)
+	}
+
+	// With -H, the split stream reads back as the files it came from
+	stream := []namedInput{{name: "-", r: strings.NewReader(wantINI)}}
+	ss, err := readFiles(readINI, stream, true, nil)(nil, optWithFilename)
+	if err != nil {
+		t.Fatalf("readFiles error: %v", err)
+	}
+	sort.Sort(ss)
+	var again bytes.Buffer
+	if err := writeGrin(ss, &again, optMonochrome); err != nil {
+		t.Fatalf("writeGrin error: %v", err)
+	}
+	if again.String() != wantGrin {
+		t.Errorf("split stream read back as:\n%s\nwant:\n%s", again.String(), wantGrin)
+	}
+}
+
+func TestUngrinURLSectionsNotSplit(t *testing.T) {
+	input := "[http://example.com]\nk = 1\n\n[www.example.org/path]\nk = 2\n"
+	var buf bytes.Buffer
+	if _, err := grinAction(strings.NewReader(input), &buf, optMonochrome); err != nil {
+		t.Fatalf("grinAction error: %v", err)
+	}
+
+	var out bytes.Buffer
+	if _, err := ungrinAction(strings.NewReader(buf.String()), &out, optMonochrome); err != nil {
+		t.Fatalf("ungrinAction error: %v", err)
+	}
+	if out.String() != input {
+		t.Errorf("round trip = %q, want %q", out.String(), input)
+	}
+}
+
+func TestSplitFileHeaders(t *testing.T) {
+	inputs, ok := splitFileHeaders("\n==> a.ini <==\nk = 1\n\n==> conf.d/b.ini <==\n[s]\nk = 2\n")
+	if !ok {
+		t.Fatal("splitFileHeaders: expected ok")
+	}
+	want := []struct{ name, text string }{
+		{"a.ini", "k = 1\n\n"},
+		{"conf.d/b.ini", "[s]\nk = 2\n"},
+	}
+	if len(inputs) != len(want) {
+		t.Fatalf("got %d inputs, want %d", len(inputs), len(want))
+	}
+	for i, w := range want {
+		text, _ := io.ReadAll(inputs[i].r)
+		if inputs[i].name != w.name || string(text) != w.text {
+			t.Errorf("input %d = %q, %q, want %q, %q", i, inputs[i].name, text, w.name, w.text)
+		}
+	}
+
+	for _, src := range []string{"", "k = 1\n==> a.ini <==\n", "==> a.ini\n"} {
+		if _, ok := splitFileHeaders(src); ok {
+			t.Errorf("splitFileHeaders(%q): expected not ok", src)
+		}
+	}
+}
+
+func TestReadFilesErrorNamesFile(t *testing.T) {
+	inputs := []namedInput{
+		{name: "good.ini", r: strings.NewReader("key = value\n")},
+		{name: "bad.ini", r: strings.NewReader("[broken\n")},
+	}
+	_, err := readFiles(readINI, inputs, true, nil)(nil, 0)
+	if err == nil || !strings.HasPrefix(err.Error(), "bad.ini: ") {
+		t.Errorf("readFiles error = %v, want it to name bad.ini", err)
+	}
+}
+
+func TestInputsReaderGrin(t *testing.T) {
+	inputs := []namedInput{
+		{name: "a.grin", r: strings.NewReader("ini.a = \"1\";\n")},
+		{name: "b.grin", r: strings.NewReader("ini.b = \"2\";\n")},
+	}
+	read, opts := inputsReader(readGrin, inputs, "grin", 0, nil)
+	if opts&optWithFilename != 0 {
+		t.Error("inputsReader: grin input should not set optWithFilename")
+	}
+
+	ss, err := read(nil, opts)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if len(ss) != 2 {
+		t.Errorf("read %d statements, want 2", len(ss))
+	}
+}
+
+func TestOpenInputs(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.ini")
+	if err := os.WriteFile(a, []byte("k = v\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	stdin := strings.NewReader("")
+	inputs, err := openInputs(nil, stdin)
+	if err != nil {
+		t.Fatalf("openInputs error: %v", err)
+	}
+	if len(inputs) != 1 || inputs[0].name != "-" || inputs[0].r != stdin {
+		t.Errorf("openInputs(nil) = %+v, want stdin", inputs)
+	}
+
+	inputs, err = openInputs([]string{a, "-"}, stdin)
+	if err != nil {
+		t.Fatalf("openInputs error: %v", err)
+	}
+	closeInputs(inputs)
+	if len(inputs) != 2 || inputs[0].name != a || inputs[1].r != stdin {
+		t.Errorf("openInputs = %+v", inputs)
+	}
+
+	if _, err := openInputs([]string{a, filepath.Join(dir, "missing.ini")}, stdin); err == nil {
+		t.Error("openInputs: expected error for missing file")
+	}
+}
+
+func TestWalkInputs(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"app.ini":            "[app]\nname = x\n",
+		"conf.d/db.conf":     "[db]\nhost = h\n",
+		"conf.d/cache.cfg":   "[cache]\nttl = 60\n",
+		"conf.d/readme.txt":  "not config\n",
+		"conf.d/deep/x.ini":  "k = v\n",
+		"other/skipped.json": "{}\n",
+	} {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatalf("MkdirAll error: %v", err)
+		}
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatalf("WriteFile error: %v", err)
+		}
+	}
+
+	var warn bytes.Buffer
+	inputs, err := walkInputs([]string{dir}, defaultIncludes, &warn)
+	if err != nil {
+		t.Fatalf("walkInputs error: %v", err)
+	}
+
+	var names []string
+	for _, in := range inputs {
+		names = append(names, in.name)
+	}
+	want := "app.ini conf.d/cache.cfg conf.d/db.conf conf.d/deep/x.ini"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("walkInputs names = %q, want %q", got, want)
+	}
+
+	if _, err := walkInputs([]string{dir}, []string{"*.yaml"}, &warn); err == nil {
+		t.Error("walkInputs: expected error when no files match")
+	}
+	if _, err := walkInputs([]string{filepath.Join(dir, "missing")}, defaultIncludes, &warn); err == nil {
+		t.Error("walkInputs: expected error for missing root")
+	}
+}
+
+func TestReadFilesSkipsBadFiles(t *testing.T) {
+	inputs := []namedInput{
+		{name: "good.ini", r: strings.NewReader("key = value\n")},
+		{name: "bad.ini", r: strings.NewReader("[broken\n")},
+		{name: "gone.ini", path: filepath.Join(t.TempDir(), "gone.ini")},
+	}
+
+	var warn bytes.Buffer
+	read, opts := inputsReader(readINI, inputs, "ini", optRecursive|optMonochrome, &warn)
+
+	var buf bytes.Buffer
+	exitCode, err := formatAction(read, writeGrin, exitFormStatements)(nil, &buf, opts)
+	if err == nil || err.Error() != "2 files could not be read" {
+		t.Errorf("error = %v, want 2 skipped files", err)
+	}
+	if exitCode != exitFormStatements {
+		t.Errorf("exit code = %d, want %d", exitCode, exitFormStatements)
+	}
+
+	wantOut := "ini = {};\nini[\"good.ini\"] = {};\nini[\"good.ini\"].key = \"value\";\n"
+	if buf.String() != wantOut {
+		t.Errorf("output = %q, want %q", buf.String(), wantOut)
+	}
+	if !strings.Contains(warn.String(), "grin: bad.ini: line 1: ") || !strings.Contains(warn.String(), "gone.ini") {
+		t.Errorf("warnings = %q, want both bad files named", warn.String())
+	}
+}
+
+func TestPatternList(t *testing.T) {
+	var p patternList
+	if err := p.Set("*.ini"); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+	if err := p.Set("*.conf"); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+	if p.String() != "*.ini,*.conf" {
+		t.Errorf("String() = %q", p.String())
+	}
+	if err := p.Set("[bad"); err == nil {
+		t.Error("Set: expected error for invalid pattern")
+	}
+}
+
+func TestInputsReaderLineNumbers(t *testing.T) {
+	inputs := []namedInput{{name: "app.ini", r: strings.NewReader("[db]\nport = 5432\n")}}
+	read, opts := inputsReader(readINI, inputs, "ini", optLineNumbers, nil)
+	if opts&optWithFilename != 0 {
+		t.Error("inputsReader: a single file should not be rooted at its name")
+	}
+
+	ss, err := read(nil, opts)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if got := statementToString(ss[len(ss)-1]); got != `ini.db.port = "5432"; // app.ini:2` {
+		t.Errorf("last statement = %q", got)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// readerFn parses input in one format into grin statements.
+type readerFn func(io.Reader, int) (statements, error)
+
+// writerFn renders grin statements in one output format.
+type writerFn func(statements, io.Writer, int) error
+
+// readers maps --from format names to their parsers.
+var readers = map[string]readerFn{
+	"ini":        readINI,
+	"grin":       readGrin,
+	"json":       readJSON,
+	"gitconfig":  readGitConfig,
+	"systemd":    readSystemd,
+	"php":        readPHP,
+	"properties": readProperties,
+	"dotenv":     readDotenv,
+	"toml":       readTOML,
+}
+
+// writers maps --to format names to their renderers.
+var writers = map[string]writerFn{
+	"grin":       writeGrin,
+	"ini":        writeINI,
+	"json":       writeJSON,
+	"values":     writeValues,
+	"gitconfig":  writeGitConfig,
+	"systemd":    writeSystemd,
+	"php":        writePHP,
+	"properties": writeProperties,
+	"dotenv":     writeDotenv,
+	"shell":      shellWriter(defaultShellStyle),
+	"toml":       writeTOML,
+	"yaml":       writeYAML,
+}
+
+// dialects are the INI dialects that --dialect accepts. Each is also the
+// name of an input and an output format.
+var dialects = map[string]bool{
+	"ini":       true,
+	"gitconfig": true,
+	"systemd":   true,
+	"php":       true,
+}
+
+// layerReaders maps the input formats that have their own rules for
+// layering files to the reader that --merge uses for them in place of
+// readLayers.
+var layerReaders = map[string]func(readerFn, []namedInput) readerFn{
+	"systemd": readSystemdUnits,
+}
+
+// formatNames returns the sorted keys of a format map for use in messages.
+func formatNames[T any](m map[string]T) string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// applyDialect reads and writes INI in the given dialect: it replaces the
+// ini format on either side with the dialect's format.
+func applyDialect(from, to, dialect string) (string, string, error) {
+	if dialect == "" {
+		return from, to, nil
+	}
+	if !dialects[dialect] {
+		return "", "", fmt.Errorf("unknown dialect %q (want one of %s)", dialect, formatNames(dialects))
+	}
+	if from == "ini" {
+		from = dialect
+	}
+	if to == "ini" {
+		to = dialect
+	}
+	return from, to, nil
+}
+
+// selectAction returns the action that reads input in the from format and
+// writes it in the to format.
+func selectAction(from, to string) (actionFn, error) {
+	read, write, failCode, err := selectFormats(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return formatAction(read, write, failCode), nil
+}
+
+// selectFormats looks up the reader for the from format and the writer for
+// the to format, along with the exit code to report if either fails.
+func selectFormats(from, to string) (readerFn, writerFn, int, error) {
+	read, ok := readers[from]
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("unknown input format %q (want one of %s)", from, formatNames(readers))
+	}
+	write, ok := writers[to]
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("unknown output format %q (want one of %s)", to, formatNames(writers))
+	}
+
+	// Grin input has its own exit code so that a bad pipeline is
+	// distinguishable from a bad INI file.
+	failCode := exitFormStatements
+	if from == "grin" {
+		failCode = exitParseStatements
+	}
+	return read, write, failCode, nil
+}
+
+// streamError reports a failure to write a line of grin or values output,
+// which exits with exitReadInput rather than the code of the reader.
+type streamError struct {
+	err error
+}
+
+func (e *streamError) Error() string {
+	return e.err.Error()
+}
+
+func (e *streamError) Unwrap() error {
+	return e.err
+}
+
+// formatAction chains a reader and a writer into an action, reporting
+// any failure with failCode, except a *streamError. Output is still
+// written if the reader only skipped some files.
+func formatAction(read readerFn, write writerFn, failCode int) actionFn {
+	return func(r io.Reader, w io.Writer, opts int) (int, error) {
+		ss, readErr := read(r, opts)
+		if readErr != nil && !isSkipped(readErr) {
+			return failCode, readErr
+		}
+		if err := write(ss, w, opts); err != nil {
+			var stream *streamError
+			if errors.As(err, &stream) {
+				return exitReadInput, err
+			}
+			return failCode, err
+		}
+		if readErr != nil {
+			return failCode, readErr
+		}
+		return exitOK, nil
+	}
+}
+
+func readINI(r io.Reader, opts int) (statements, error) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	return statementsFromINI(r, prefix, opts)
+}
+
+func readGrin(r io.Reader, opts int) (statements, error) {
+	return ungrinStatements(r)
+}
+
+func readJSON(r io.Reader, opts int) (statements, error) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	return statementsFromJSON(r, prefix, opts)
+}
+
+func readGitConfig(r io.Reader, opts int) (statements, error) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	return statementsFromGitConfig(r, prefix, opts)
+}
+
+func readSystemd(r io.Reader, opts int) (statements, error) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	return statementsFromSystemd(r, prefix, opts)
+}
+
+func readPHP(r io.Reader, opts int) (statements, error) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	return statementsFromPHP(r, prefix, opts)
+}
+
+func readProperties(r io.Reader, opts int) (statements, error) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	return statementsFromProperties(r, prefix, opts)
+}
+
+func readDotenv(r io.Reader, opts int) (statements, error) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	return statementsFromDotenv(r, prefix, opts)
+}
+
+func readTOML(r io.Reader, opts int) (statements, error) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	return statementsFromTOML(r, prefix, opts)
+}
+
+func writeGrin(ss statements, w io.Writer, opts int) error {
+	var conv statementconv
+	if opts&optMonochrome > 0 {
+		conv = statementToString
+	} else {
+		conv = statementToColorString
+	}
+
+	if opts&optNoSort == 0 {
+		sort.Sort(ss)
+	}
+
+	for _, s := range ss {
+		if _, err := fmt.Fprintln(w, conv(s)); err != nil {
+			return &streamError{err}
+		}
+	}
+	return nil
+}
+
+func writeINI(ss statements, w io.Writer, opts int) error {
+	if opts&optNormalizeDelimiters > 0 {
+		ss = withoutAttribute(ss, "delimiter")
+	}
+	if opts&optWithFilename > 0 {
+		return ungrinFiles(ss, w)
+	}
+	return ungrinFromStatements(ss, w)
+}
+
+func writeGitConfig(ss statements, w io.Writer, opts int) error {
+	return gitConfigFromStatements(ss, w)
+}
+
+func writeSystemd(ss statements, w io.Writer, opts int) error {
+	return systemdFromStatements(ss, w)
+}
+
+func writePHP(ss statements, w io.Writer, opts int) error {
+	return phpFromStatements(ss, w)
+}
+
+func writeProperties(ss statements, w io.Writer, opts int) error {
+	return propertiesFromStatements(ss, w)
+}
+
+func writeDotenv(ss statements, w io.Writer, opts int) error {
+	return dotenvFromStatements(ss, w)
+}
+
+func writeTOML(ss statements, w io.Writer, opts int) error {
+	return tomlFromStatements(ss, w, opts&optTypes > 0)
+}
+
+func writeYAML(ss statements, w io.Writer, opts int) error {
+	if opts&optNoSort == 0 {
+		sort.Sort(ss)
+	}
+	return yamlFromStatements(ss, w, opts&optTypes > 0)
+}
+
+func writeJSON(ss statements, w io.Writer, opts int) error {
+	if opts&optNoSort == 0 {
+		sort.Sort(ss)
+	}
+	return jsonFromStatements(ss, w)
+}
+
+func writeValues(ss statements, w io.Writer, opts int) error {
+	for _, s := range ss {
+		if _, value, ok := splitAssignment(s); ok && value.isScalar() {
+			if _, err := fmt.Fprintln(w, unquoteString(value.text)); err != nil {
+				return &streamError{err}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestResolveFormats(t *testing.T) {
+	tests := []struct {
+		from, to             string
+		ungrin, values, json bool
+		shell                bool
+		wantFrom, wantTo     string
+	}{
+		{"", "", false, false, false, false, "ini", "grin"},
+		{"", "", true, false, false, false, "grin", "ini"},
+		{"", "", false, true, false, false, "ini", "values"},
+		{"", "", false, false, true, false, "ini", "json"},
+		{"", "", true, false, true, false, "grin", "ini"},
+		{"", "", true, true, false, false, "grin", "ini"},
+		{"", "", true, false, false, true, "grin", "ini"},
+		{"", "json", true, false, false, false, "grin", "json"},
+		{"json", "", false, false, false, false, "json", "grin"},
+		{"json", "ini", false, false, false, false, "json", "ini"},
+		{"", "ini", false, false, true, false, "ini", "ini"},
+		{"", "", false, false, false, true, "ini", "shell"},
+		{"", "json", false, false, false, true, "ini", "json"},
+	}
+
+	for _, tt := range tests {
+		from, to := resolveFormats(tt.from, tt.to, tt.ungrin, tt.values, tt.json, tt.shell)
+		if from != tt.wantFrom || to != tt.wantTo {
+			t.Errorf("resolveFormats(%q, %q, %v, %v, %v, %v) = (%q, %q), want (%q, %q)",
+				tt.from, tt.to, tt.ungrin, tt.values, tt.json, tt.shell, from, to, tt.wantFrom, tt.wantTo)
+		}
+	}
+}
+
+func TestApplyDialect(t *testing.T) {
+	tests := []struct {
+		from, to, dialect string
+		wantFrom, wantTo  string
+	}{
+		{"ini", "grin", "", "ini", "grin"},
+		{"ini", "grin", "systemd", "systemd", "grin"},
+		{"grin", "ini", "gitconfig", "grin", "gitconfig"},
+		{"ini", "ini", "systemd", "systemd", "systemd"},
+		{"json", "values", "systemd", "json", "values"},
+	}
+
+	for _, tt := range tests {
+		from, to, err := applyDialect(tt.from, tt.to, tt.dialect)
+		if err != nil {
+			t.Errorf("applyDialect(%q, %q, %q) error: %v", tt.from, tt.to, tt.dialect, err)
+			continue
+		}
+		if from != tt.wantFrom || to != tt.wantTo {
+			t.Errorf("applyDialect(%q, %q, %q) = (%q, %q), want (%q, %q)",
+				tt.from, tt.to, tt.dialect, from, to, tt.wantFrom, tt.wantTo)
+		}
+	}
+
+	if _, _, err := applyDialect("ini", "grin", "xml"); err == nil {
+		t.Error("expected error for unknown dialect, got nil")
+	}
+}
+
+func TestSelectActionUnknownFormat(t *testing.T) {
+	if _, err := selectAction("xml", "grin"); err == nil {
+		t.Error("expected error for unknown input format, got nil")
+	}
+	if _, err := selectAction("ini", "xml"); err == nil {
+		t.Error("expected error for unknown output format, got nil")
+	}
+}
+
+func TestSelectActionJSONToINI(t *testing.T) {
+	input := `{"app": "myapp", "database": {"host": "localhost", "port": 5432}}`
+
+	a, err := selectAction("json", "ini")
+	if err != nil {
+		t.Fatalf("selectAction error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	exitCode, err := a(strings.NewReader(input), &buf, optMonochrome)
+	if err != nil {
+		t.Fatalf("action error: %v", err)
+	}
+	if exitCode != exitOK {
+		t.Fatalf("action exit code: %d", exitCode)
+	}
+
+	want := "app = myapp\n\n[database]\nhost = localhost\nport = 5432\n"
+	if buf.String() != want {
+		t.Errorf("json -> ini output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestSelectActionNormalizeDelimiters(t *testing.T) {
+	input := "[tool]\nname: app\nurl = http://x:80\n"
+
+	tests := []struct {
+		opts int
+		want string
+	}{
+		{optMonochrome, "[tool]\nname: app\nurl = http://x:80\n"},
+		{optMonochrome | optNormalizeDelimiters, "[tool]\nname = app\nurl = http://x:80\n"},
+	}
+
+	for _, tt := range tests {
+		a, err := selectAction("ini", "ini")
+		if err != nil {
+			t.Fatalf("selectAction error: %v", err)
+		}
+		var buf bytes.Buffer
+		if _, err := a(strings.NewReader(input), &buf, tt.opts|optNoSort); err != nil {
+			t.Fatalf("action error: %v", err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("opts %d: output = %q, want %q", tt.opts, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestSelectActionExitCodes(t *testing.T) {
+	tests := []struct {
+		from, to string
+		input    string
+		want     int
+	}{
+		{"ini", "grin", "[broken\n", exitFormStatements},
+		{"json", "grin", "[1]", exitFormStatements},
+		{"grin", "ini", "not grin", exitParseStatements},
+	}
+
+	for _, tt := range tests {
+		a, err := selectAction(tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("selectAction(%q, %q) error: %v", tt.from, tt.to, err)
+		}
+		var buf bytes.Buffer
+		exitCode, err := a(strings.NewReader(tt.input), &buf, optMonochrome)
+		if err == nil {
+			t.Errorf("%s -> %s: expected error, got nil", tt.from, tt.to)
+		}
+		if exitCode != tt.want {
+			t.Errorf("%s -> %s: exit code = %d, want %d", tt.from, tt.to, exitCode, tt.want)
+		}
+	}
+}
+
+func TestSelectActionWriteExitCodes(t *testing.T) {
+	tests := []struct {
+		from, to string
+		input    string
+		want     int
+	}{
+		{"ini", "grin", "key = value\n", exitReadInput},
+		{"ini", "values", "key = value\n", exitReadInput},
+		{"json", "values", `{"key": "value"}`, exitReadInput},
+		{"ini", "json", "key = value\n", exitFormStatements},
+		{"grin", "ini", `ini.key = "value";`, exitParseStatements},
+	}
+
+	for _, tt := range tests {
+		a, err := selectAction(tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("selectAction(%q, %q) error: %v", tt.from, tt.to, err)
+		}
+		exitCode, err := a(strings.NewReader(tt.input), failingWriter{}, optMonochrome)
+		if err == nil {
+			t.Errorf("%s -> %s: expected error, got nil", tt.from, tt.to)
+		}
+		if exitCode != tt.want {
+			t.Errorf("%s -> %s: exit code = %d, want %d", tt.from, tt.to, exitCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// gitSection is a git config section header: a case-insensitive name and
+// an optional, case-sensitive subsection.
+type gitSection struct {
+	name   string
+	sub    string
+	hasSub bool
+}
+
+// key returns the name under which iniData stores the section.
+func (s gitSection) key() string {
+	if !s.hasSub {
+		return s.name
+	}
+	return s.name + " " + quoteString(s.sub)
+}
+
+// gitEscapes maps the characters that may follow a backslash in a git
+// config value to the characters they stand for.
+var gitEscapes = map[byte]byte{
+	'"':  '"',
+	'\\': '\\',
+	'n':  '\n',
+	't':  '\t',
+	'b':  '\b',
+}
+
+// gitValueEscaper escapes a value for writing back to a git config file.
+var gitValueEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\t", `\t`,
+	"\b", `\b`,
+)
+
+// gitSubsectionEscaper escapes a subsection name for a section header.
+var gitSubsectionEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// gitValue decodes a git config value, which may continue over several
+// lines that end with a backslash.
+type gitValue struct {
+	pair    iniKVPair
+	b       strings.Builder
+	quoted  bool
+	pending string
+	comment string
+}
+
+// add decodes one line of the value, reporting whether it continues on
+// the next. Outside of double quotes, a ; or # starts a comment, and
+// whitespace is only kept between other characters.
+func (v *gitValue) add(text string, lineNum int) (more bool, err error) {
+scan:
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\' && i == len(text)-1:
+			return true, nil
+		case c == '\\':
+			i++
+			esc, ok := gitEscapes[text[i]]
+			if !ok {
+				return false, fmt.Errorf("line %d: invalid escape \\%c", lineNum, text[i])
+			}
+			v.write(esc)
+		case c == '"':
+			v.flush()
+			v.quoted = !v.quoted
+		case v.quoted:
+			v.write(c)
+		case c == ';' || c == '#':
+			v.comment = strings.TrimSpace(text[i:])
+			break scan
+		case c == ' ' || c == '\t':
+			// As in git, each whitespace character is kept as a space
+			if v.b.Len() > 0 {
+				v.pending += " "
+			}
+		default:
+			v.write(c)
+		}
+	}
+
+	if v.quoted {
+		return false, fmt.Errorf("line %d: unterminated quote", lineNum)
+	}
+	return false, nil
+}
+
+// write adds c to the value, after any whitespace that preceded it.
+func (v *gitValue) write(c byte) {
+	v.flush()
+	v.b.WriteByte(c)
+}
+
+// flush adds pending whitespace, which is now known to be inside the value.
+func (v *gitValue) flush() {
+	v.b.WriteString(v.pending)
+	v.pending = ""
+}
+
+// gitConfigReader holds the state of reading a git config file.
+type gitConfigReader struct {
+	data           iniData
+	sections       map[string]gitSection
+	section        gitSection
+	inSection      bool
+	pendingComment []string
+	// open is the value being read, which continues on the next line.
+	open *gitValue
+}
+
+// statementsFromGitConfig reads a git config file from r, such as
+// ~/.gitconfig or .git/config, and produces grin statements rooted at
+// prefix. Section and key names are case-insensitive and are lowered;
+// a subsection becomes a quoted path component, as in
+// ini.remote["origin"].url. Keys that occur more than once, such as
+// fetch, are given indexes. Values are unquoted and unescaped as git does,
+// and a key without a value is true.
+func statementsFromGitConfig(r io.Reader, prefix statement, opts int) (statements, error) {
+	g := &gitConfigReader{
+		data: iniData{
+			sectionKeys:     make(map[string][]iniKVPair),
+			sectionComments: make(map[string]string),
+			sectionLines:    make(map[string]int),
+		},
+		sections: make(map[string]gitSection),
+	}
+	g.data.sectionPath = g.sectionPath
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if lineNum == 1 {
+			line = stripBOM(line)
+		}
+		if err := g.readLine(line, lineNum); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+	if g.open != nil {
+		return nil, fmt.Errorf("line %d: value continues past the end of the input", g.open.pair.line)
+	}
+	g.data.trailingComment = strings.Join(g.pendingComment, "\n")
+
+	return buildINIStatements(prefix, &g.data, opts), nil
+}
+
+// readLine reads one line of the file: a comment, a section header, a key,
+// or the continuation of a value.
+func (g *gitConfigReader) readLine(line string, lineNum int) error {
+	if g.open == nil {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			return nil
+		case trimmed[0] == ';' || trimmed[0] == '#':
+			g.pendingComment = append(g.pendingComment, trimmed)
+			return nil
+		case trimmed[0] == '[':
+			return g.startSection(trimmed, lineNum)
+		}
+
+		rest, err := g.startKey(trimmed, lineNum)
+		if err != nil {
+			return err
+		}
+		line = rest
+	}
+
+	more, err := g.open.add(line, lineNum)
+	if err != nil {
+		return err
+	}
+	if !more {
+		g.open.pair.value, g.open.pair.inlineComment = g.open.b.String(), g.open.comment
+		g.data.addKey(g.section.key(), g.open.pair)
+		g.open = nil
+	}
+	return nil
+}
+
+// takeComment returns the comment lines read since the last section or key.
+func (g *gitConfigReader) takeComment() string {
+	comment := strings.Join(g.pendingComment, "\n")
+	g.pendingComment = nil
+	return comment
+}
+
+// startSection records the section header trimmed.
+func (g *gitConfigReader) startSection(trimmed string, lineNum int) error {
+	s, err := parseGitSection(trimmed, lineNum)
+	if err != nil {
+		return err
+	}
+	g.section, g.inSection = s, true
+	g.sections[s.key()] = s
+	g.data.addSection(s.key(), g.takeComment(), lineNum)
+	return nil
+}
+
+// startKey opens the value of the key line trimmed, returning the text of
+// the line that holds the value.
+func (g *gitConfigReader) startKey(trimmed string, lineNum int) (string, error) {
+	if !g.inSection {
+		return "", fmt.Errorf("line %d: key outside of a section", lineNum)
+	}
+	key, rest, hasValue, err := parseGitKey(trimmed, lineNum)
+	if err != nil {
+		return "", err
+	}
+
+	g.open = &gitValue{pair: iniKVPair{key: key, comment: g.takeComment(), line: lineNum, delimiter: "="}}
+	if !hasValue {
+		// A key on its own is a boolean set to true
+		g.open.b.WriteString("true")
+	}
+	return rest, nil
+}
+
+// sectionPath returns the paths of the section stored under key: the
+// section itself, and the subsection below it if there is one.
+func (g *gitConfigReader) sectionPath(prefix statement, key string) []statement {
+	s := g.sections[key]
+	path := prefix.withKey(s.name)
+	if !s.hasSub {
+		return []statement{path}
+	}
+	return []statement{path, path.withQuotedKey(s.sub)}
+}
+
+// parseGitSection parses a trimmed git config section header: [section],
+// [section "subsection"], or the deprecated [section.subsection], whose
+// subsection is case-insensitive like its name.
+func parseGitSection(trimmed string, lineNum int) (gitSection, error) {
+	end := 1
+	for end < len(trimmed) && (isGitNameChar(trimmed[end]) || trimmed[end] == '.') {
+		end++
+	}
+	name, rest := strings.ToLower(trimmed[1:end]), trimmed[end:]
+	if name == "" {
+		return gitSection{}, fmt.Errorf("line %d: empty section name", lineNum)
+	}
+
+	var s gitSection
+	switch {
+	case strings.HasPrefix(rest, "]"):
+		s.name, s.sub, s.hasSub = strings.Cut(name, ".")
+		rest = rest[1:]
+	case (rest != "" && (rest[0] == ' ' || rest[0] == '\t')) && !strings.Contains(name, "."):
+		sub, after, err := parseGitSubsection(strings.TrimLeft(rest, " \t"), lineNum)
+		if err != nil {
+			return gitSection{}, err
+		}
+		s = gitSection{name: name, sub: sub, hasSub: true}
+		rest = after
+	default:
+		return gitSection{}, fmt.Errorf("line %d: invalid section header %q", lineNum, trimmed)
+	}
+
+	if rest = strings.TrimSpace(rest); rest != "" && rest[0] != ';' && rest[0] != '#' {
+		return gitSection{}, fmt.Errorf("line %d: unexpected %q after section header", lineNum, rest)
+	}
+	return s, nil
+}
+
+// parseGitSubsection parses the quoted subsection of a section header and
+// its closing bracket, returning the subsection and the text after them.
+// A backslash makes the character after it literal.
+func parseGitSubsection(text string, lineNum int) (sub, rest string, err error) {
+	if !strings.HasPrefix(text, `"`) {
+		return "", "", fmt.Errorf("line %d: expected a quoted subsection", lineNum)
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\\' && i+1 < len(text):
+			i++
+			b.WriteByte(text[i])
+		case c == '"':
+			if !strings.HasPrefix(text[i+1:], "]") {
+				return "", "", fmt.Errorf("line %d: expected ']' after subsection", lineNum)
+			}
+			return b.String(), text[i+2:], nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("line %d: unclosed section header", lineNum)
+}
+
+// parseGitKey splits a trimmed key line into its lowered key name and the
+// text after the '=' that holds its value. hasValue is false for a key
+// on its own, when rest holds no more than a comment.
+func parseGitKey(trimmed string, lineNum int) (key, rest string, hasValue bool, err error) {
+	end := 0
+	for end < len(trimmed) && isGitNameChar(trimmed[end]) {
+		end++
+	}
+	key, rest = strings.ToLower(trimmed[:end]), strings.TrimLeft(trimmed[end:], " \t")
+	if key == "" || key[0] < 'a' || key[0] > 'z' {
+		return "", "", false, fmt.Errorf("line %d: invalid key in %q", lineNum, trimmed)
+	}
+
+	switch {
+	case strings.HasPrefix(rest, "="):
+		return key, rest[1:], true, nil
+	case rest == "" || rest[0] == ';' || rest[0] == '#':
+		return key, rest, false, nil
+	default:
+		return "", "", false, fmt.Errorf("line %d: expected key = value, got %q", lineNum, trimmed)
+	}
+}
+
+// isGitNameChar reports whether c may appear in a git config section or
+// key name.
+func isGitNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-'
+}
+
+// gitConfigFromStatements writes statements as a git config file. A
+// section path of one component becomes [section]; the components after
+// the first of a longer one become the subsection, as in
+// [remote "origin"]. Keys are indented with a tab as git writes them, and
+// values are quoted and escaped where git requires it.
+func gitConfigFromStatements(ss statements, w io.Writer) error {
+	globalKeys, sections, sectionOrder, emptyOnlySections := indexStatements(ss)
+	if len(globalKeys) > 0 {
+		return fmt.Errorf("key %q is not in a section, as git config requires", globalKeys[0].key)
+	}
+	comments, sectionComments := indexComments(ss)
+	attrs, _ := indexAttributes(ss)
+
+	for _, secName := range sectionOrder {
+		kvs := sections[secName]
+		if len(kvs) == 0 && (!emptyOnlySections[secName] || hasSubsection(sectionOrder, secName)) {
+			continue
+		}
+		if err := writeComment(w, sectionComments[secName]); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, gitSectionHeader(secName)); err != nil {
+			return err
+		}
+		for _, kv := range kvs {
+			if err := checkINIKey(kv.key); err != nil {
+				return err
+			}
+			if err := writeComment(w, comments[kv.commentKey()]); err != nil {
+				return err
+			}
+			line := "\t" + kv.key + " = " + formatGitValue(kv.value)
+			if comment := attrs[kv.commentKey()]["comment"]; comment != "" {
+				line += " " + comment
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return writeComment(w, sectionComments[""])
+}
+
+// hasSubsection reports whether any of names is a subsection of section.
+func hasSubsection(names []string, section string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, section+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// gitSectionHeader returns the header for a dotted section name. Git
+// section names can't contain dots, so everything after the first is the
+// subsection.
+func gitSectionHeader(name string) string {
+	section, sub, ok := strings.Cut(name, ".")
+	if !ok {
+		return "[" + section + "]"
+	}
+	return "[" + section + ` "` + gitSubsectionEscaper.Replace(sub) + `"]`
+}
+
+// formatGitValue escapes value for a git config file, quoting it if it
+// has surrounding spaces or characters that would start a comment.
+func formatGitValue(value string) string {
+	escaped := gitValueEscaper.Replace(value)
+	if strings.Trim(value, " ") != value || strings.ContainsAny(value, ";#") {
+		return `"` + escaped + `"`
+	}
+	return escaped
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStatementsFromGitConfig(t *testing.T) {
+	input := `# identity
+[User]
+	Name = Jane Doe
+	email = "jane@example.com" ; work
+[core]
+	bare
+	editor = vim -c \"set tw=72\"
+	pager = "less -R  "
+[remote "origin"]
+	url = git@github.com:me/repo.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	Fetch = +refs/tags/*:refs/tags/*
+[url "https://github.com/"]
+	insteadOf = gh:
+[alias]
+	lg = log --graph \
+	  --oneline
+	s = status\t-s
+[branch.Dev]
+	remote = upstream
+[branch "Main"]
+	remote = origin
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromGitConfig(strings.NewReader(input), prefix, optComments)
+	if err != nil {
+		t.Fatalf("statementsFromGitConfig error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.user # "# identity";`,
+		`ini.user = {};`,
+		`ini.user.name = "Jane Doe";`,
+		`ini.user.email = "jane@example.com";`,
+		`ini.user.email@comment = "; work";`,
+		`ini.core = {};`,
+		`ini.core.bare = "true";`,
+		`ini.core.editor = "vim -c \"set tw=72\"";`,
+		`ini.core.pager = "less -R  ";`,
+		`ini.remote = {};`,
+		`ini.remote["origin"] = {};`,
+		`ini.remote["origin"].url = "git@github.com:me/repo.git";`,
+		`ini.remote["origin"].fetch[0] = "+refs/heads/*:refs/remotes/origin/*";`,
+		`ini.remote["origin"].fetch[1] = "+refs/tags/*:refs/tags/*";`,
+		`ini.url = {};`,
+		`ini.url["https://github.com/"] = {};`,
+		`ini.url["https://github.com/"].insteadof = "gh:";`,
+		`ini.alias = {};`,
+		`ini.alias.lg = "log --graph    --oneline";`,
+		`ini.alias.s = "status\t-s";`,
+		`ini.branch = {};`,
+		`ini.branch["dev"] = {};`,
+		`ini.branch["dev"].remote = "upstream";`,
+		`ini.branch["Main"] = {};`,
+		`ini.branch["Main"].remote = "origin";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestStatementsFromGitConfigErrors(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{"key outside a section", "name = x\n"},
+		{"unclosed header", "[core\n"},
+		{"unclosed subsection", "[remote \"origin]\n"},
+		{"text after header", "[core] bare\n"},
+		{"dotted name with subsection", "[a.b \"c\"]\n"},
+		{"invalid key", "[core]\n2fa = on\n"},
+		{"missing equals", "[core]\nbare true\n"},
+		{"invalid escape", "[core]\neditor = a\\qb\n"},
+		{"unterminated quote", "[core]\npager = \"less\n"},
+		{"continued past the end", "[core]\npager = less \\\n"},
+	}
+
+	prefix := statement{{text: "ini", typ: typBare}}
+	for _, tt := range tests {
+		if _, err := statementsFromGitConfig(strings.NewReader(tt.input), prefix, 0); err == nil {
+			t.Errorf("%s: expected error, got nil", tt.desc)
+		}
+	}
+}
+
+func TestGitConfigFromStatements(t *testing.T) {
+	input := `ini = {};
+ini.user # "# identity";
+ini.user = {};
+ini.user.name = "Jane Doe";
+ini.user.email = "jane@example.com";
+ini.user.email@comment = "; work";
+ini.core = {};
+ini.core.pager = "less -R  ";
+ini.core.editor = "vim -c \"set tw=72\"";
+ini.alias = {};
+ini.alias.s = "status\t-s\n";
+ini.alias.x = "a;b";
+ini.remote = {};
+ini.remote["origin"] = {};
+ini.remote["origin"].fetch[1] = "+refs/tags/*:refs/tags/*";
+ini.remote["origin"].fetch[0] = "+refs/heads/*:refs/remotes/origin/*";
+ini.url["https://github.com/"].insteadof = "gh:";
+ini.empty = {};
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := gitConfigFromStatements(ss, &buf); err != nil {
+		t.Fatalf("gitConfigFromStatements error: %v", err)
+	}
+
+	want := `# identity
+[user]
+	name = Jane Doe
+	email = jane@example.com ; work
+[core]
+	pager = "less -R  "
+	editor = vim -c \"set tw=72\"
+[alias]
+	s = status\t-s\n
+	x = "a;b"
+[remote "origin"]
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+[url "https://github.com/"]
+	insteadof = gh:
+[empty]
+`
+	if buf.String() != want {
+		t.Errorf("git config output:\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// And back again
+	prefix := statement{{text: "ini", typ: typBare}}
+	again, err := statementsFromGitConfig(strings.NewReader(buf.String()), prefix, optComments)
+	if err != nil {
+		t.Fatalf("statementsFromGitConfig error: %v", err)
+	}
+	values := assignmentValues(again)
+	for path, value := range assignmentValues(ss) {
+		if values[path].text != value.text {
+			t.Errorf("round trip %s = %s, want %s", path, values[path].text, value.text)
+		}
+	}
+}
+
+func TestGitConfigFromStatementsGlobalKey(t *testing.T) {
+	ss := statements{statement{{text: "ini", typ: typBare}}.withBare("name").withStringValue("x")}
+	if err := gitConfigFromStatements(ss, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for a key outside a section, got nil")
+	}
+}
+
+func TestGitSectionHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"core", "[core]"},
+		{"remote.origin", `[remote "origin"]`},
+		{"url.https://example.com/", `[url "https://example.com/"]`},
+		{`a.say "hi" \o/`, `[a "say \"hi\" \\o/"]`},
+	}
+
+	for _, tt := range tests {
+		if got := gitSectionHeader(tt.name); got != tt.want {
+			t.Errorf("gitSectionHeader(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -10,25 +10,195 @@ import (
 
 // iniKVPair holds a parsed key-value pair from an INI line.
 type iniKVPair struct {
-	key   string
-	value string
+	key     string
+	value   string
+	comment string
+	line    int
+	// continuation is the style in which a multi-line value was written.
+	continuation string
+	// inlineComment is the comment that followed the value on its line.
+	inlineComment string
+	// delimiter separated the key from its value.
+	delimiter string
+	// array is set for a PHP array key, such as extension[] or
+	// key[name], and offset holds the name between its brackets; appended
+	// is set for the first form. A TOML array sets array alone.
+	array    bool
+	offset   string
+	appended bool
+	// quote is the quote character a PHP value was written in, if any.
+	quote string
+}
+
+// iniDelimiters are the characters that can separate a key from its value.
+// The first of them on a line is the delimiter, as in Python's configparser.
+const iniDelimiters = "=:"
+
+// delimiterIndex returns the position of the delimiter on a key line, or
+// -1 if there is none.
+func delimiterIndex(line string) int {
+	return strings.IndexAny(line, iniDelimiters)
+}
+
+// checkINIKey reports an error if key contains a delimiter, which would
+// end the key early when the line is read back.
+func checkINIKey(key string) error {
+	if strings.ContainsAny(key, iniDelimiters) {
+		return fmt.Errorf("key %q contains a delimiter, which INI can't express", key)
+	}
+	return nil
+}
+
+// Continuation styles of multi-line values.
+const (
+	// contIndent continues a value on lines indented deeper than its key,
+	// as Python's configparser does.
+	contIndent = "indent"
+	// contBackslash continues a value on the line after one that ends with
+	// a backslash.
+	contBackslash = "backslash"
+)
+
+// openValue is a key whose value may continue on the lines that follow.
+type openValue struct {
+	pair    iniKVPair
+	section string
+	indent  int
+	// backslash is set when the last line of the value ended with one,
+	// and backslashes when that continues the value.
+	backslash   bool
+	backslashes bool
+	// blanks counts the blank lines after the value, which are part of it
+	// if a continuation line follows them.
+	blanks int
+}
+
+// newOpenValue starts a value with the key line it was read from. With
+// optBackslashContinuations, a value that ends with a backslash continues
+// on the next line.
+func newOpenValue(section string, pair iniKVPair, line string, opts int) *openValue {
+	v := &openValue{
+		pair:        pair,
+		section:     section,
+		indent:      indentWidth(line),
+		backslashes: opts&optBackslashContinuations > 0,
+	}
+	if value, more := trimContinuation(pair.value); more && v.backslashes {
+		v.pair.value = value
+		v.pair.continuation = contBackslash
+		v.backslash = true
+	}
+	return v
+}
+
+// add appends line to the value if it is a continuation line, reporting
+// whether it was. Any line after a backslash is one, as is a non-comment
+// line indented deeper than the key. A blank line is held, reporting true,
+// and kept in the value only if a continuation line follows it.
+func (v *openValue) add(line string) bool {
+	if v == nil {
+		return false
+	}
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case v.backslash:
+	case trimmed == "":
+		v.blanks++
+		return true
+	case trimmed[0] != ';' && trimmed[0] != '#' && indentWidth(line) > v.indent:
+		v.pair.continuation = contIndent
+	default:
+		return false
+	}
+
+	text, more := trimmed, false
+	if v.backslashes {
+		text, more = trimContinuation(trimmed)
+	}
+	v.pair.value += strings.Repeat("\n", v.blanks+1) + text
+	v.blanks = 0
+	v.backslash = more
+	return true
+}
+
+// indentWidth returns the number of spaces and tabs that line starts with.
+func indentWidth(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// trimContinuation removes a trailing backslash, and the space before it,
+// from text, reporting whether there was one.
+func trimContinuation(text string) (string, bool) {
+	if !strings.HasSuffix(text, "\\") {
+		return text, false
+	}
+	return strings.TrimRight(text[:len(text)-1], " \t"), true
+}
+
+// continuationLines lays out a multi-line value in the given continuation
+// style. It returns the text for the key line, after the delimiter, and
+// the lines that follow it.
+func continuationLines(value, style string) (first string, rest []string) {
+	lines := strings.Split(value, "\n")
+	if style == contBackslash {
+		for i := range lines[:len(lines)-1] {
+			if lines[i] == "" {
+				lines[i] = "\\"
+			} else {
+				lines[i] += " \\"
+			}
+		}
+	}
+	for _, l := range lines[1:] {
+		if l != "" {
+			l = "    " + l
+		}
+		rest = append(rest, l)
+	}
+	return lines[0], rest
+}
+
+// iniData holds the parsed contents of an INI file: global keys, sections in
+// the order they were first declared, and the comments attached to them.
+type iniData struct {
+	globalKeys      []iniKVPair
+	sectionOrder    []string
+	sectionKeys     map[string][]iniKVPair
+	sectionComments map[string]string
+	// sectionLines holds the line of each section's first header.
+	sectionLines map[string]int
+	// trailingComment holds comments after the last key or section header.
+	trailingComment string
+	// sectionPath, if set, returns the paths for a section name in place
+	// of sectionPaths' dotted names.
+	sectionPath func(prefix statement, name string) []statement
 }
 
 // statementsFromINI reads INI data from r and produces a slice of grin
 // statements. The prefix is the root statement (typically just "ini").
-func statementsFromINI(r io.Reader, prefix statement) (statements, error) {
+// With optComments, comment lines are kept as comment statements attached
+// to the key or section header that follows them. With optInlineComments,
+// comments after a value are removed from it, and kept as an attribute of
+// the key with optComments. With optLineNumbers, each key and section
+// header records the line it was read from. Values continue on lines
+// indented deeper than their key, even after blank lines, and with
+// optBackslashContinuations after a line that ends with a backslash.
+func statementsFromINI(r io.Reader, prefix statement, opts int) (statements, error) {
 	scanner := bufio.NewScanner(r)
 
 	var (
 		currentSection string
-		sectionOrder   []string
-		sectionKeys    = make(map[string][]iniKVPair)
-		globalKeys     []iniKVPair
-		seenSections   = make(map[string]bool)
+		pendingComment []string
 		lineNum        int
 		firstLine      = true
+		data           = iniData{
+			sectionKeys:     make(map[string][]iniKVPair),
+			sectionComments: make(map[string]string),
+			sectionLines:    make(map[string]int),
+		}
 	)
 
+	var open *openValue
 	for scanner.Scan() {
 		line := scanner.Text()
 		lineNum++
@@ -37,11 +207,21 @@ func statementsFromINI(r io.Reader, prefix statement) (statements, error) {
 			line = stripBOM(line)
 			firstLine = false
 		}
+		if open.add(line) {
+			continue
+		}
 
 		trimmed := strings.TrimSpace(line)
-		if trimmed == "" || trimmed[0] == ';' || trimmed[0] == '#' {
+		if trimmed == "" {
 			continue
 		}
+		if trimmed[0] == ';' || trimmed[0] == '#' {
+			pendingComment = append(pendingComment, trimmed)
+			continue
+		}
+		open = data.close(open)
+		comment := strings.Join(pendingComment, "\n")
+		pendingComment = nil
 
 		if trimmed[0] == '[' {
 			sectionName, err := parseSectionHeader(trimmed, lineNum)
@@ -49,58 +229,201 @@ func statementsFromINI(r io.Reader, prefix statement) (statements, error) {
 				return nil, err
 			}
 			currentSection = sectionName
-			if !seenSections[sectionName] {
-				seenSections[sectionName] = true
-				sectionOrder = append(sectionOrder, sectionName)
-			}
+			data.addSection(sectionName, comment, lineNum)
 			continue
 		}
 
-		key, value, err := parseINIKeyValue(trimmed, lineNum)
+		pair, err := parseINIKeyValue(trimmed, lineNum, opts)
 		if err != nil {
 			return nil, err
 		}
-
-		pair := iniKVPair{key: key, value: value}
-		if currentSection == "" {
-			globalKeys = append(globalKeys, pair)
-		} else {
-			sectionKeys[currentSection] = append(sectionKeys[currentSection], pair)
-		}
+		pair.comment = comment
+		open = newOpenValue(currentSection, pair, line, opts)
 	}
+	data.close(open)
 
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("reading input: %w", err)
 	}
+	data.trailingComment = strings.Join(pendingComment, "\n")
+
+	return buildINIStatements(prefix, &data, opts), nil
+}
+
+// addSection records a section header, keeping the order in which sections
+// were first declared. Comments on repeated headers are concatenated.
+func (d *iniData) addSection(name, comment string, line int) {
+	existing, seen := d.sectionComments[name]
+	if !seen {
+		d.sectionOrder = append(d.sectionOrder, name)
+		d.sectionLines[name] = line
+	}
+	d.sectionComments[name] = joinComments(existing, comment)
+}
 
-	return buildINIStatements(prefix, globalKeys, sectionOrder, sectionKeys), nil
+// close records the key of an open value, returning nil to clear it.
+func (d *iniData) close(v *openValue) *openValue {
+	if v != nil {
+		d.addKey(v.section, v.pair)
+	}
+	return nil
+}
+
+// addKey records a key under section, or as a global key if section is "".
+func (d *iniData) addKey(section string, pair iniKVPair) {
+	if section == "" {
+		d.globalKeys = append(d.globalKeys, pair)
+	} else {
+		d.sectionKeys[section] = append(d.sectionKeys[section], pair)
+	}
+}
+
+// setKey records pair under section in place of any earlier key of the
+// same name, for formats in which a later assignment replaces the value.
+// The comments of the earlier key are kept with it.
+func (d *iniData) setKey(section string, pair iniKVPair) {
+	keys := d.globalKeys
+	if section != "" {
+		keys = d.sectionKeys[section]
+	}
+	kept := keys[:0]
+	for _, kv := range keys {
+		if kv.key != pair.key || kv.array != pair.array || kv.offset != pair.offset {
+			kept = append(kept, kv)
+			continue
+		}
+		// The comments on the key still describe it
+		pair.comment = joinComments(kv.comment, pair.comment)
+	}
+	if section == "" {
+		d.globalKeys = kept
+	} else {
+		d.sectionKeys[section] = kept
+	}
+	d.addKey(section, pair)
+}
+
+// joinComments concatenates two comment blocks, either of which may be empty.
+func joinComments(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + "\n" + b
 }
 
 // buildINIStatements assembles the final statement slice from the parsed INI
 // data: a root object, global keys, and ordered sections with their keys.
-func buildINIStatements(prefix statement, globalKeys []iniKVPair, sectionOrder []string, sectionKeys map[string][]iniKVPair) statements {
-	ss := statements{}
-	ss = append(ss, prefix.withEmptyObject())
+// Comment statements are only included with optComments, and source
+// positions with optLineNumbers.
+func buildINIStatements(prefix statement, d *iniData, opts int) statements {
+	withComments := opts&optComments > 0
+	ss := statements{prefix.withEmptyObject()}
 
-	for _, kv := range globalKeys {
-		ss = append(ss, prefix.withBare(kv.key).withStringValue(kv.value))
-	}
+	ss = appendKeyStatements(ss, prefix, d.globalKeys, opts)
 
 	emitted := make(map[string]bool)
-	for _, secName := range sectionOrder {
-		parts := strings.Split(secName, ".")
-		for i := 1; i <= len(parts); i++ {
-			partial := strings.Join(parts[:i], ".")
-			if !emitted[partial] {
-				emitted[partial] = true
-				ss = append(ss, prefix.withPath(partial).withEmptyObject())
+	for _, secName := range d.sectionOrder {
+		paths := d.sectionPaths(prefix, secName)
+		path := paths[len(paths)-1]
+		if withComments && d.sectionComments[secName] != "" {
+			ss = append(ss, path.withComment(d.sectionComments[secName]))
+		}
+		for i, p := range paths {
+			id := statementToString(p)
+			if emitted[id] {
+				continue
 			}
+			emitted[id] = true
+			s := p.withEmptyObject()
+			if opts&optLineNumbers > 0 && i == len(paths)-1 {
+				s = s.withPosition(d.sectionLines[secName])
+			}
+			ss = append(ss, s)
 		}
-		for _, kv := range sectionKeys[secName] {
-			ss = append(ss, prefix.withPath(secName).withBare(kv.key).withStringValue(kv.value))
+		ss = appendKeyStatements(ss, path, d.sectionKeys[secName], opts)
+	}
+
+	if withComments && d.trailingComment != "" {
+		ss = append(ss, prefix.withComment(d.trailingComment))
+	}
+	return ss
+}
+
+// sectionPaths returns the path of section name below prefix, preceded by
+// the paths of the sections it is nested in.
+func (d *iniData) sectionPaths(prefix statement, name string) []statement {
+	if d.sectionPath != nil {
+		return d.sectionPath(prefix, name)
+	}
+	parts := sectionParts(name)
+	paths := make([]statement, len(parts))
+	for i := range parts {
+		paths[i] = prefix.withKeys(parts[:i+1])
+	}
+	return paths
+}
+
+// appendKeyStatements appends the statements for the keys of one section
+// to ss. Keys that occur more than once in a section get an index segment
+// per occurrence so that none of them is lost, as do PHP keys such as
+// extension[], numbered along with plain keys of the same name; a PHP
+// key[name] gets name as a path segment.
+func appendKeyStatements(ss statements, path statement, pairs []iniKVPair, opts int) statements {
+	counts := make(map[string]int)
+	for _, kv := range pairs {
+		if kv.offset == "" {
+			counts[kv.key]++
 		}
 	}
+	seen := make(map[string]int)
+	for _, kv := range pairs {
+		keyPath := path.withKey(kv.key)
+		switch {
+		case kv.array && kv.offset != "":
+			keyPath = keyPath.withKey(kv.offset)
+		case kv.array || counts[kv.key] > 1:
+			// Each key[] adds an element, even the first
+			keyPath = keyPath.withIndex(seen[kv.key])
+			seen[kv.key]++
+		}
+		if opts&optComments > 0 && kv.comment != "" {
+			ss = append(ss, keyPath.withComment(kv.comment))
+		}
+		s := keyPath.withValue(valueToken(kv.value, opts&optTypes > 0))
+		if opts&optLineNumbers > 0 {
+			s = s.withPosition(kv.line)
+		}
+		ss = append(ss, s)
+		ss = appendKeyAttributes(ss, keyPath, kv, opts)
+	}
+	return ss
+}
 
+// appendKeyAttributes appends the attribute statements that record how
+// the key at keyPath was written, leaving out those that hold the default.
+func appendKeyAttributes(ss statements, keyPath statement, kv iniKVPair, opts int) statements {
+	// Indentation is the default way of continuing values
+	if kv.continuation == contBackslash {
+		ss = append(ss, keyPath.withAttribute("continuation").withStringValue(kv.continuation))
+	}
+	// Equals is the default delimiter
+	if kv.delimiter != "=" {
+		ss = append(ss, keyPath.withAttribute("delimiter").withStringValue(kv.delimiter))
+	}
+	if kv.quote != "" {
+		ss = append(ss, keyPath.withAttribute("quote").withStringValue(kv.quote))
+	}
+	// The offset of a PHP key[name] is a path component like a section's,
+	// and a key[] is an element like a repeated key
+	switch {
+	case kv.array && kv.offset != "":
+		ss = append(ss, keyPath.withAttribute("array").withStringValue("offset"))
+	case kv.appended:
+		ss = append(ss, keyPath.withAttribute("array").withStringValue("append"))
+	}
+	if opts&optComments > 0 && kv.inlineComment != "" {
+		ss = append(ss, keyPath.withAttribute("comment").withStringValue(kv.inlineComment))
+	}
 	return ss
 }
 
@@ -115,30 +438,68 @@ func parseSectionHeader(trimmed string, lineNum int) (string, error) {
 	if sectionName == "" {
 		return "", fmt.Errorf("line %d: empty section name", lineNum)
 	}
-	for _, p := range strings.Split(sectionName, ".") {
+	return sectionName, nil
+}
+
+// sectionParts splits a section name into path components. A dotted name
+// made up of valid identifiers (database.pool) describes nested sections;
+// any other name, such as "http://example.com", is kept whole.
+func sectionParts(name string) []string {
+	parts := strings.Split(name, ".")
+	for _, p := range parts {
 		if !validIdentifier(p) {
-			return "", fmt.Errorf("line %d: invalid section name part %q", lineNum, p)
+			return []string{name}
 		}
 	}
-	return sectionName, nil
+	return parts
 }
 
-// parseINIKeyValue parses a trimmed key=value line.
-// Returns (key, stripped-value) or an error.
-func parseINIKeyValue(trimmed string, lineNum int) (string, string, error) {
-	eqIdx := strings.IndexByte(trimmed, '=')
+// parseINIKeyValue parses a trimmed key=value or key: value line into a
+// pair with its value unquoted. With optInlineComments, a comment after
+// the value is split off into the pair's inlineComment.
+func parseINIKeyValue(trimmed string, lineNum, opts int) (iniKVPair, error) {
+	eqIdx := delimiterIndex(trimmed)
 	if eqIdx == -1 {
-		return "", "", fmt.Errorf("line %d: expected key = value, got %q", lineNum, trimmed)
+		return iniKVPair{}, fmt.Errorf("line %d: expected key = value, got %q", lineNum, trimmed)
+	}
+	pair := iniKVPair{
+		key:       strings.TrimSpace(trimmed[:eqIdx]),
+		line:      lineNum,
+		delimiter: trimmed[eqIdx : eqIdx+1],
+	}
+	if pair.key == "" {
+		return iniKVPair{}, fmt.Errorf("line %d: empty key", lineNum)
+	}
+
+	value := trimmed[eqIdx+1:]
+	if opts&optInlineComments > 0 {
+		value, pair.inlineComment = splitInlineComment(value)
+		// A backslash continues the value, even after a comment
+		if comment, more := trimContinuation(pair.inlineComment); more {
+			value, pair.inlineComment = value+" \\", comment
+		}
 	}
-	key := strings.TrimSpace(trimmed[:eqIdx])
-	value := strings.TrimSpace(trimmed[eqIdx+1:])
-	if key == "" {
-		return "", "", fmt.Errorf("line %d: empty key", lineNum)
+	pair.value = stripINIQuotes(strings.TrimSpace(value))
+	return pair, nil
+}
+
+// splitInlineComment splits the comment off the text after a delimiter.
+// As in Python's configparser, a comment starts with ';' or '#' after
+// whitespace; inside a quoted value neither starts one.
+func splitInlineComment(text string) (value, comment string) {
+	start := len(text) - len(strings.TrimLeft(text, " \t"))
+	if q := text[start:]; q != "" && (q[0] == '"' || q[0] == '\'') {
+		if end := strings.IndexByte(q[1:], q[0]); end >= 0 {
+			start += end + 2
+		}
 	}
-	if !validIdentifier(key) {
-		return "", "", fmt.Errorf("line %d: invalid key %q", lineNum, key)
+
+	for i := start; i < len(text); i++ {
+		if (text[i] == ';' || text[i] == '#') && i > 0 && (text[i-1] == ' ' || text[i-1] == '\t') {
+			return text[:i], strings.TrimSpace(text[i:])
+		}
 	}
-	return key, stripINIQuotes(value), nil
+	return text, ""
 }
 
 // stripBOM removes a UTF-8 BOM from the beginning of a string if present.
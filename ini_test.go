@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 )
@@ -11,7 +12,7 @@ key1 = value1
 key2 = value2
 `
 	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(strings.NewReader(input), prefix)
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -43,7 +44,7 @@ version = 1.0
 key = value
 `
 	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(strings.NewReader(input), prefix)
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -79,7 +80,7 @@ max = 10
 enabled = true
 `
 	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(strings.NewReader(input), prefix)
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -116,7 +117,7 @@ key = value
 key2 = value2
 `
 	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(strings.NewReader(input), prefix)
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -140,6 +141,51 @@ key2 = value2
 	}
 }
 
+func TestStatementsFromINIKeepComments(t *testing.T) {
+	input := `; File header
+# second line
+
+[section]
+; Key comment
+key = value
+key2 = value2
+
+; Other section
+[other]
+key = value
+; Trailing comment
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, optComments)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.section # "; File header\n# second line";`,
+		`ini.section = {};`,
+		`ini.section.key # "; Key comment";`,
+		`ini.section.key = "value";`,
+		`ini.section.key2 = "value2";`,
+		`ini.other # "; Other section";`,
+		`ini.other = {};`,
+		`ini.other.key = "value";`,
+		`ini # "; Trailing comment";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+
+	for i, w := range want {
+		got := statementToString(ss[i])
+		if got != w {
+			t.Errorf("statement[%d] = %q, want %q", i, got, w)
+		}
+	}
+}
+
 func TestStatementsFromINIQuotedValues(t *testing.T) {
 	input := `[section]
 double = "hello world"
@@ -147,7 +193,7 @@ single = 'hello world'
 unquoted = hello world
 `
 	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(strings.NewReader(input), prefix)
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -175,7 +221,7 @@ unquoted = hello world
 func TestStatementsFromINIEmpty(t *testing.T) {
 	input := ""
 	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(strings.NewReader(input), prefix)
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -196,7 +242,7 @@ func TestStatementsFromINIEmptyValue(t *testing.T) {
 key =
 `
 	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(strings.NewReader(input), prefix)
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -224,7 +270,7 @@ func TestStatementsFromINIValueWithEquals(t *testing.T) {
 key = val=ue
 `
 	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(strings.NewReader(input), prefix)
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -240,7 +286,7 @@ key = val=ue
 func TestStatementsFromINIBOM(t *testing.T) {
 	input := "\xEF\xBB\xBF[section]\nkey = value\n"
 	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(strings.NewReader(input), prefix)
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -260,7 +306,7 @@ key1 = value1
 key2 = value2
 `
 	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(strings.NewReader(input), prefix)
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -285,6 +331,44 @@ key2 = value2
 	}
 }
 
+func TestStatementsFromINIDuplicateKeys(t *testing.T) {
+	input := `name = one
+name = two
+
+[php]
+extension = curl
+memory_limit = 128M
+extension = gd
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Repeated keys are indexed per occurrence; single keys are not
+	want := []string{
+		`ini = {};`,
+		`ini.name[0] = "one";`,
+		`ini.name[1] = "two";`,
+		`ini.php = {};`,
+		`ini.php.extension[0] = "curl";`,
+		`ini.php.memory_limit = "128M";`,
+		`ini.php.extension[1] = "gd";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+
+	for i, w := range want {
+		got := statementToString(ss[i])
+		if got != w {
+			t.Errorf("statement[%d] = %q, want %q", i, got, w)
+		}
+	}
+}
+
 func TestStatementsFromINIEmptySection(t *testing.T) {
 	input := `[empty]
 
@@ -292,7 +376,7 @@ func TestStatementsFromINIEmptySection(t *testing.T) {
 key = value
 `
 	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(strings.NewReader(input), prefix)
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -316,12 +400,410 @@ key = value
 	}
 }
 
+func TestStatementsFromINILineNumbers(t *testing.T) {
+	input := `; header
+name = app
+
+[database.pool]
+max = 20
+min = 5
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, optLineNumbers)
+	if err != nil {
+		t.Fatalf("statementsFromINI error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.name = "app"; // 2`,
+		`ini.database = {};`,
+		`ini.database.pool = {}; // 4`,
+		`ini.database.pool.max = "20"; // 5`,
+		`ini.database.pool.min = "5"; // 6`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestStatementsFromINITypes(t *testing.T) {
+	input := `[server]
+port = 5432
+ratio = 0.5
+debug = yes
+verbose = off
+enabled = On
+mode = 0755
+name = web
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, optTypes)
+	if err != nil {
+		t.Fatalf("statementsFromINI error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.server = {};`,
+		`ini.server.port = 5432;`,
+		`ini.server.ratio = 0.5;`,
+		`ini.server.debug = yes;`,
+		`ini.server.verbose = off;`,
+		`ini.server.enabled = On;`,
+		`ini.server.mode = "0755";`,
+		`ini.server.name = "web";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jsonFromStatements(ss, &buf); err != nil {
+		t.Fatalf("jsonFromStatements error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"enabled": true,`) {
+		t.Errorf("JSON output does not type On as true:\n%s", buf.String())
+	}
+}
+
+func TestStatementsFromINIContinuations(t *testing.T) {
+	input := `[options]
+install_requires =
+    requests>=2
+    click
+; not part of the value
+python_requires = >=3.8
+
+[paths]
+search = /usr/lib \
+  /usr/local/lib \
+/opt/lib
+name = x
+    indented more
+
+    after blank
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, optBackslashContinuations)
+	if err != nil {
+		t.Fatalf("statementsFromINI error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.options = {};`,
+		`ini.options.install_requires = "\nrequests>=2\nclick";`,
+		`ini.options.python_requires = ">=3.8";`,
+		`ini.paths = {};`,
+		`ini.paths.search = "/usr/lib\n/usr/local/lib\n/opt/lib";`,
+		`ini.paths.search@continuation = "backslash";`,
+		`ini.paths.name = "x\nindented more\n\nafter blank";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestStatementsFromINIBlankLinesInValue(t *testing.T) {
+	input := "deps = a\n  b\n\n  c\n\nnext = 1\n"
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromINI error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.deps = "a\nb\n\nc";`,
+		`ini.next = "1";`,
+	}
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ungrinFromStatements(ss, &buf); err != nil {
+		t.Fatalf("ungrinFromStatements error: %v", err)
+	}
+	if want := "deps = a\n    b\n\n    c\nnext = 1\n"; buf.String() != want {
+		t.Errorf("ungrin output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestStatementsFromINITrailingBackslash(t *testing.T) {
+	input := "[p]\nroot = C:\\Temp\\\nlogs = D:\\logs\n"
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromINI error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.p = {};`,
+		`ini.p.root = "C:\\Temp\\";`,
+		`ini.p.logs = "D:\\logs";`,
+	}
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestContinuationLines(t *testing.T) {
+	tests := []struct {
+		value string
+		style string
+		first string
+		rest  []string
+	}{
+		{"one", contIndent, "one", nil},
+		{"one", contBackslash, "one", nil},
+		{"\na\nb", "", "", []string{"    a", "    b"}},
+		{"a\n\nb", contBackslash, "a \\", []string{"    \\", "    b"}},
+	}
+
+	for _, tt := range tests {
+		first, rest := continuationLines(tt.value, tt.style)
+		if first != tt.first || strings.Join(rest, "|") != strings.Join(tt.rest, "|") {
+			t.Errorf("continuationLines(%q, %q) = %q, %q; want %q, %q", tt.value, tt.style, first, rest, tt.first, tt.rest)
+		}
+	}
+}
+
+func TestStatementsFromINIInlineComments(t *testing.T) {
+	input := `[mysqld]
+port = 5432 ; default
+name = "a ; b" # quoted
+url = http://example.com/#top
+empty = ; nothing
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+
+	tests := []struct {
+		opts int
+		want []string
+	}{
+		{0, []string{
+			`ini = {};`,
+			`ini.mysqld = {};`,
+			`ini.mysqld.port = "5432 ; default";`,
+			`ini.mysqld.name = "\"a ; b\" # quoted";`,
+			`ini.mysqld.url = "http://example.com/#top";`,
+			`ini.mysqld.empty = "; nothing";`,
+		}},
+		{optInlineComments, []string{
+			`ini = {};`,
+			`ini.mysqld = {};`,
+			`ini.mysqld.port = "5432";`,
+			`ini.mysqld.name = "a ; b";`,
+			`ini.mysqld.url = "http://example.com/#top";`,
+			`ini.mysqld.empty = "";`,
+		}},
+		{optInlineComments | optComments, []string{
+			`ini = {};`,
+			`ini.mysqld = {};`,
+			`ini.mysqld.port = "5432";`,
+			`ini.mysqld.port@comment = "; default";`,
+			`ini.mysqld.name = "a ; b";`,
+			`ini.mysqld.name@comment = "# quoted";`,
+			`ini.mysqld.url = "http://example.com/#top";`,
+			`ini.mysqld.empty = "";`,
+			`ini.mysqld.empty@comment = "; nothing";`,
+		}},
+	}
+
+	for _, tt := range tests {
+		ss, err := statementsFromINI(strings.NewReader(input), prefix, tt.opts)
+		if err != nil {
+			t.Fatalf("statementsFromINI error: %v", err)
+		}
+		if len(ss) != len(tt.want) {
+			t.Fatalf("opts %d: got %d statements, want %d", tt.opts, len(ss), len(tt.want))
+		}
+		for i, s := range ss {
+			if got := statementToString(s); got != tt.want[i] {
+				t.Errorf("opts %d: statement %d: got %q, want %q", tt.opts, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestSplitInlineComment(t *testing.T) {
+	tests := []struct {
+		text    string
+		value   string
+		comment string
+	}{
+		{" 5432", " 5432", ""},
+		{" 5432 ; default", " 5432 ", "; default"},
+		{" 5432\t# default", " 5432\t", "# default"},
+		{" a;b#c", " a;b#c", ""},
+		{` "a ; b" ; c`, ` "a ; b" `, "; c"},
+		{` 'a # b'`, ` 'a # b'`, ""},
+		{` "unclosed ; c`, ` "unclosed `, "; c"},
+		{"; c", "; c", ""},
+	}
+
+	for _, tt := range tests {
+		value, comment := splitInlineComment(tt.text)
+		if value != tt.value || comment != tt.comment {
+			t.Errorf("splitInlineComment(%q) = %q, %q; want %q, %q", tt.text, value, comment, tt.value, tt.comment)
+		}
+	}
+}
+
+func TestStatementsFromINIDelimiters(t *testing.T) {
+	input := `[tool]
+name: app
+url = http://example.com:8080
+time : 12:30
+empty:
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromINI error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.tool = {};`,
+		`ini.tool.name = "app";`,
+		`ini.tool.name@delimiter = ":";`,
+		`ini.tool.url = "http://example.com:8080";`,
+		`ini.tool.time = "12:30";`,
+		`ini.tool.time@delimiter = ":";`,
+		`ini.tool.empty = "";`,
+		`ini.tool.empty@delimiter = ":";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestStatementsFromINIQuotedKeys(t *testing.T) {
+	input := `2fa_enabled = 1
+
+[http://example.com]
+my key = value
+
+[has space]
+key = value
+
+[database.pool]
+max.conns = 10
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Names that aren't valid identifiers become quoted path components;
+	// dotted identifiers still nest.
+	want := []string{
+		`ini = {};`,
+		`ini["2fa_enabled"] = "1";`,
+		`ini["http://example.com"] = {};`,
+		`ini["http://example.com"]["my key"] = "value";`,
+		`ini["has space"] = {};`,
+		`ini["has space"].key = "value";`,
+		`ini.database = {};`,
+		`ini.database.pool = {};`,
+		`ini.database.pool["max.conns"] = "10";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+
+	for i, w := range want {
+		got := statementToString(ss[i])
+		if got != w {
+			t.Errorf("statement[%d] = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestINIDataSetKey(t *testing.T) {
+	d := iniData{sectionKeys: make(map[string][]iniKVPair)}
+	d.setKey("", iniKVPair{key: "a", value: "1", comment: "; first"})
+	d.setKey("", iniKVPair{key: "b", value: "2"})
+	d.setKey("", iniKVPair{key: "a", value: "3", comment: "; again"})
+	d.setKey("s", iniKVPair{key: "a", value: "4"})
+
+	if len(d.globalKeys) != 2 {
+		t.Fatalf("got %d global keys, want 2", len(d.globalKeys))
+	}
+	if kv := d.globalKeys[1]; kv.key != "a" || kv.value != "3" || kv.comment != "; first\n; again" {
+		t.Errorf("replaced key = %+v", kv)
+	}
+	if kvs := d.sectionKeys["s"]; len(kvs) != 1 || kvs[0].value != "4" {
+		t.Errorf("section keys = %+v", kvs)
+	}
+}
+
+func TestSectionParts(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"section", []string{"section"}},
+		{"database.pool", []string{"database", "pool"}},
+		{"http://example.com", []string{"http://example.com"}},
+		{"has space.sub", []string{"has space.sub"}},
+		{"a..b", []string{"a..b"}},
+	}
+
+	for _, tt := range tests {
+		got := sectionParts(tt.input)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("sectionParts(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
 // Error cases
 
 func TestStatementsFromINIUnclosedSection(t *testing.T) {
 	input := "[section\nkey = value\n"
 	prefix := statement{{text: "ini", typ: typBare}}
-	_, err := statementsFromINI(strings.NewReader(input), prefix)
+	_, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err == nil {
 		t.Fatal("expected error for unclosed section, got nil")
 	}
@@ -330,25 +812,16 @@ func TestStatementsFromINIUnclosedSection(t *testing.T) {
 func TestStatementsFromINIEmptySectionName(t *testing.T) {
 	input := "[]\nkey = value\n"
 	prefix := statement{{text: "ini", typ: typBare}}
-	_, err := statementsFromINI(strings.NewReader(input), prefix)
+	_, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err == nil {
 		t.Fatal("expected error for empty section name, got nil")
 	}
 }
 
-func TestStatementsFromINIInvalidKey(t *testing.T) {
-	input := "[section]\n123 = value\n"
-	prefix := statement{{text: "ini", typ: typBare}}
-	_, err := statementsFromINI(strings.NewReader(input), prefix)
-	if err == nil {
-		t.Fatal("expected error for invalid key, got nil")
-	}
-}
-
 func TestStatementsFromININoEquals(t *testing.T) {
 	input := "[section]\nnotavalidline\n"
 	prefix := statement{{text: "ini", typ: typBare}}
-	_, err := statementsFromINI(strings.NewReader(input), prefix)
+	_, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err == nil {
 		t.Fatal("expected error for line without =, got nil")
 	}
@@ -357,21 +830,12 @@ func TestStatementsFromININoEquals(t *testing.T) {
 func TestStatementsFromINIEmptyKey(t *testing.T) {
 	input := "[section]\n = value\n"
 	prefix := statement{{text: "ini", typ: typBare}}
-	_, err := statementsFromINI(strings.NewReader(input), prefix)
+	_, err := statementsFromINI(strings.NewReader(input), prefix, 0)
 	if err == nil {
 		t.Fatal("expected error for empty key, got nil")
 	}
 }
 
-func TestStatementsFromINIInvalidSectionName(t *testing.T) {
-	input := "[has space]\nkey = value\n"
-	prefix := statement{{text: "ini", typ: typBare}}
-	_, err := statementsFromINI(strings.NewReader(input), prefix)
-	if err == nil {
-		t.Fatal("expected error for invalid section name, got nil")
-	}
-}
-
 func TestStripBOM(t *testing.T) {
 	tests := []struct {
 		input string
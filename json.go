@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// statementsFromJSON reads a JSON object from r and produces grin
+// statements rooted at prefix. Nested objects become (dotted) sections,
+// arrays of scalars become repeated keys and scalar values become strings,
+// or with optTypes, numbers and booleans keep their types; nulls have no
+// INI equivalent and are rejected.
+func statementsFromJSON(r io.Reader, prefix statement, opts int) (statements, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("reading JSON: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, errors.New("reading JSON: top-level value must be an object")
+	}
+
+	ss := statements{prefix.withEmptyObject()}
+	ss, err = jsonObjectStatements(dec, prefix, ss, opts&optTypes > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("reading JSON: unexpected data after top-level object")
+	}
+	return ss, nil
+}
+
+// jsonObjectStatements appends statements for the members of the object
+// whose opening brace has just been read, consuming its closing brace.
+// With types, numbers and booleans keep their types.
+func jsonObjectStatements(dec *json.Decoder, prefix statement, ss statements, types bool) (statements, error) {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("reading JSON: %w", err)
+		}
+		path := prefix.withKey(tok.(string))
+
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("reading JSON: %w", err)
+		}
+		if d, ok := tok.(json.Delim); ok {
+			switch d {
+			case '{':
+				ss = append(ss, path.withEmptyObject())
+				ss, err = jsonObjectStatements(dec, path, ss, types)
+			case '[':
+				ss, err = jsonArrayStatements(dec, path, ss, types)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		value, err := jsonScalar(tok, path, types)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, path.withValue(value))
+	}
+
+	// Closing brace
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("reading JSON: %w", err)
+	}
+	return ss, nil
+}
+
+// jsonArrayStatements appends one indexed statement per element of the
+// array whose opening bracket has just been read, consuming its closing
+// bracket. Elements must be scalars, as they become repeated INI keys.
+func jsonArrayStatements(dec *json.Decoder, path statement, ss statements, types bool) (statements, error) {
+	for i := 0; dec.More(); i++ {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("reading JSON: %w", err)
+		}
+		if _, ok := tok.(json.Delim); ok {
+			return nil, fmt.Errorf("reading JSON: %s: lists may only hold scalar values", statementToString(path))
+		}
+		value, err := jsonScalar(tok, path, types)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, path.withIndex(i).withValue(value))
+	}
+
+	// Closing bracket
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("reading JSON: %w", err)
+	}
+	return ss, nil
+}
+
+// jsonScalar converts a scalar JSON token into the token of an INI
+// value: a string, or with types, a number or boolean for those.
+func jsonScalar(tok json.Token, path statement, types bool) (token, error) {
+	switch v := tok.(type) {
+	case string:
+		return valueToken(v, false), nil
+	case json.Number:
+		if types {
+			return token{v.String(), typNumber}, nil
+		}
+		return valueToken(v.String(), false), nil
+	case bool:
+		return valueToken(strconv.FormatBool(v), types), nil
+	default:
+		return token{}, fmt.Errorf("reading JSON: %s: null values are not supported", statementToString(path))
+	}
+}
+
+// jsonFromStatements renders statements as a nested JSON document. Dotted
+// section names become nested objects, repeated keys become arrays and
+// values are JSON strings, except the numbers and booleans that --types
+// gives those types.
+// Keys are written in the order the statements present them.
+func jsonFromStatements(ss statements, w io.Writer) error {
+	root, err := treeFromStatements(ss)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	writeJSONNode(&b, root, 0)
+	b.WriteByte('\n')
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// writeJSONNode appends n to b at the given indentation depth.
+func writeJSONNode(b *strings.Builder, n *node, depth int) {
+	if n.isLeaf {
+		b.WriteString(jsonValue(n))
+		return
+	}
+	if n.isArray {
+		writeJSONArray(b, n.sortedItems(), depth)
+		return
+	}
+	if len(n.keys) == 0 {
+		b.WriteString("{}")
+		return
+	}
+
+	indent := strings.Repeat("  ", depth+1)
+	b.WriteString("{\n")
+	for i, k := range n.keys {
+		b.WriteString(indent)
+		b.WriteString(quoteString(k))
+		b.WriteString(": ")
+		writeJSONNode(b, n.children[k], depth+1)
+		if i < len(n.keys)-1 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteByte('}')
+}
+
+// writeJSONArray appends a list of values to b at the given depth.
+func writeJSONArray(b *strings.Builder, values []*node, depth int) {
+	indent := strings.Repeat("  ", depth+1)
+	b.WriteString("[\n")
+	for i, v := range values {
+		b.WriteString(indent)
+		b.WriteString(jsonValue(v))
+		if i < len(values)-1 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteByte(']')
+}
+
+// jsonValue returns the JSON for the value of leaf: a number or boolean
+// for the values that --types gives those types, and a string otherwise.
+func jsonValue(leaf *node) string {
+	switch leaf.typ {
+	case typNumber:
+		return leaf.value
+	case typBoolean:
+		b, _ := booleanValue(leaf.value)
+		return strconv.FormatBool(b)
+	}
+	return quoteString(leaf.value)
+}
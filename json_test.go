@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJSONFromStatements(t *testing.T) {
+	input := `ini = {};
+ini.name = "grin";
+ini.database = {};
+ini.database.host = "localhost";
+ini.database.pool = {};
+ini.database.pool.max = "10";
+ini.empty = {};
+ini.quoted = "say \"hi\"";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jsonFromStatements(ss, &buf); err != nil {
+		t.Fatalf("jsonFromStatements error: %v", err)
+	}
+
+	want := `{
+  "name": "grin",
+  "database": {
+    "host": "localhost",
+    "pool": {
+      "max": "10"
+    }
+  },
+  "empty": {},
+  "quoted": "say \"hi\""
+}
+`
+	if buf.String() != want {
+		t.Errorf("json output = \n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestJSONFromStatementsEmpty(t *testing.T) {
+	ss := statements{makeEmptyObj("ini")}
+
+	var buf bytes.Buffer
+	if err := jsonFromStatements(ss, &buf); err != nil {
+		t.Fatalf("jsonFromStatements error: %v", err)
+	}
+
+	if buf.String() != "{}\n" {
+		t.Errorf("json output = %q, want %q", buf.String(), "{}\n")
+	}
+}
+
+func TestStatementsFromJSON(t *testing.T) {
+	input := `{
+  "name": "grin",
+  "database": {
+    "host": "localhost",
+    "port": 5432,
+    "pool": {"enabled": true, "ratio": 0.5}
+  }
+}`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromJSON(strings.NewReader(input), prefix, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.name = "grin";`,
+		`ini.database = {};`,
+		`ini.database.host = "localhost";`,
+		`ini.database.port = "5432";`,
+		`ini.database.pool = {};`,
+		`ini.database.pool.enabled = "true";`,
+		`ini.database.pool.ratio = "0.5";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+
+	for i, w := range want {
+		got := statementToString(ss[i])
+		if got != w {
+			t.Errorf("statement[%d] = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestJSONTypes(t *testing.T) {
+	input := `{
+  "name": "grin",
+  "database": {
+    "port": 5432,
+    "ratio": 0.5,
+    "enabled": true,
+    "mode": "0755"
+  },
+  "ports": [
+    80,
+    443
+  ]
+}
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromJSON(strings.NewReader(input), prefix, optTypes)
+	if err != nil {
+		t.Fatalf("statementsFromJSON error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.name = "grin";`,
+		`ini.database = {};`,
+		`ini.database.port = 5432;`,
+		`ini.database.ratio = 0.5;`,
+		`ini.database.enabled = true;`,
+		`ini.database.mode = "0755";`,
+		`ini.ports[0] = 80;`,
+		`ini.ports[1] = 443;`,
+	}
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, w := range want {
+		if got := statementToString(ss[i]); got != w {
+			t.Errorf("statement[%d] = %q, want %q", i, got, w)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jsonFromStatements(ss, &buf); err != nil {
+		t.Fatalf("jsonFromStatements error: %v", err)
+	}
+	if buf.String() != input {
+		t.Errorf("round-trip mismatch:\ngot:\n%s\nwant:\n%s", buf.String(), input)
+	}
+}
+
+func TestJSONFromTypedStatements(t *testing.T) {
+	input := `ini.port = 5432;
+ini.debug = yes;
+ini.quiet = off;
+ini.version = "2";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jsonFromStatements(ss, &buf); err != nil {
+		t.Fatalf("jsonFromStatements error: %v", err)
+	}
+
+	want := `{
+  "port": 5432,
+  "debug": true,
+  "quiet": false,
+  "version": "2"
+}
+`
+	if buf.String() != want {
+		t.Errorf("json output = \n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestStatementsFromJSONErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		desc  string
+	}{
+		{``, "empty input"},
+		{`[]`, "top-level array"},
+		{`"str"`, "top-level string"},
+		{`{"a": [{"b": 1}]}`, "object in array"},
+		{`{"a": [[1]]}`, "array in array"},
+		{`{"a": [null]}`, "null in array"},
+		{`{"a": null}`, "null value"},
+		{`{"a": "v"`, "unterminated object"},
+		{`{"a": "v"} {}`, "trailing data"},
+	}
+
+	prefix := statement{{text: "ini", typ: typBare}}
+	for _, tt := range tests {
+		_, err := statementsFromJSON(strings.NewReader(tt.input), prefix, 0)
+		if err == nil {
+			t.Errorf("statementsFromJSON(%q) [%s]: expected error, got nil", tt.input, tt.desc)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := `{
+  "name": "grin",
+  "database": {
+    "host": "localhost",
+    "pool": {
+      "max": "10"
+    }
+  },
+  "empty": {}
+}
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromJSON(strings.NewReader(input), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromJSON error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jsonFromStatements(ss, &buf); err != nil {
+		t.Fatalf("jsonFromStatements error: %v", err)
+	}
+
+	if buf.String() != input {
+		t.Errorf("round-trip mismatch:\ngot:\n%s\nwant:\n%s", buf.String(), input)
+	}
+}
+
+func TestJSONArrays(t *testing.T) {
+	input := `{
+  "php": {
+    "extension": [
+      "curl",
+      "gd"
+    ]
+  }
+}
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromJSON(strings.NewReader(input), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromJSON error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.php = {};`,
+		`ini.php.extension[0] = "curl";`,
+		`ini.php.extension[1] = "gd";`,
+	}
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, w := range want {
+		if got := statementToString(ss[i]); got != w {
+			t.Errorf("statement[%d] = %q, want %q", i, got, w)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jsonFromStatements(ss, &buf); err != nil {
+		t.Fatalf("jsonFromStatements error: %v", err)
+	}
+	if buf.String() != input {
+		t.Errorf("round-trip mismatch:\ngot:\n%s\nwant:\n%s", buf.String(), input)
+	}
+}
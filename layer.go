@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+)
+
+// layerEntry holds the statements for one path of a layered configuration
+// and the file that supplied them.
+type layerEntry struct {
+	ss     statements
+	origin string
+}
+
+// layerIdentity returns the path that s assigns (or comments on) with any
+// index removed, so that every occurrence of a repeated key shares one
+// identity and a later file's list replaces an earlier one as a whole. An
+// attribute has the identity of its key, so that it is replaced along with
+// the key's value.
+func layerIdentity(s statement) string {
+	var id statement
+	for _, t := range s {
+		switch t.typ {
+		case typEquals, typAt:
+			return statementToString(id)
+		case typHash:
+			return "#" + statementToString(id)
+		case typNumericKey:
+			// Drop the "[" before the index; the "]" after it is skipped next
+			id = id[:len(id)-1]
+		case typRBrace:
+			if len(id) == 0 || id[len(id)-1].typ != typQuotedKey {
+				continue
+			}
+			id = append(id, t)
+		default:
+			id = append(id, t)
+		}
+	}
+	return statementToString(id)
+}
+
+// mergeLayers merges the statements of several files by path, with later
+// files taking precedence: each path keeps the position at which it was
+// first seen and the value from the last file that sets it. names holds
+// the name of each file, used by showOrigin to attach a comment naming the
+// file that supplied each value.
+func mergeLayers(layers []statements, names []string, showOrigin bool) statements {
+	var order []string
+	entries := make(map[string]*layerEntry)
+
+	for i, layer := range layers {
+		seen := make(map[string]bool)
+		for _, s := range layer {
+			id := layerIdentity(s)
+			e, ok := entries[id]
+			switch {
+			case !ok:
+				e = &layerEntry{}
+				entries[id] = e
+				order = append(order, id)
+			case !seen[id]:
+				// Replace what earlier files said
+				e.ss = nil
+			}
+			seen[id] = true
+			e.origin = names[i]
+			e.ss = append(e.ss, s)
+		}
+	}
+
+	var merged statements
+	for _, id := range order {
+		e := entries[id]
+		for _, s := range e.ss {
+			if path, value, ok := splitAssignment(s); ok && showOrigin && value.typ != typEmptyObject {
+				merged = append(merged, path.withComment(e.origin))
+			}
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// readLayers returns a reader that reads each of inputs with read, in place
+// of the input it is given, and merges them with mergeLayers.
+func readLayers(read readerFn, inputs []namedInput) readerFn {
+	return func(_ io.Reader, opts int) (statements, error) {
+		layers := make([]statements, len(inputs))
+		names := make([]string, len(inputs))
+		for i, in := range inputs {
+			ss, err := readInput(read, in, opts)
+			if err != nil {
+				return nil, err
+			}
+			layers[i] = ss
+			names[i] = in.name
+		}
+		return mergeLayers(layers, names, opts&optShowOrigin > 0), nil
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLayerIdentity(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`ini.database.port = "5432";`, "ini.database.port"},
+		{`ini.php.extension[2] = "gd";`, "ini.php.extension"},
+		{`ini["my section"]["a key"][0] = "v";`, `ini["my section"]["a key"]`},
+		{`ini.database = {};`, "ini.database"},
+		{`ini.database.port # "; note";`, "#ini.database.port"},
+		{`ini.database.port@delimiter = ":";`, "ini.database.port"},
+		{`ini.php.extension[1]@comment = "; note";`, "ini.php.extension"},
+	}
+
+	for _, tt := range tests {
+		ss, err := ungrinStatements(strings.NewReader(tt.input))
+		if err != nil {
+			t.Fatalf("ungrinStatements(%q) error: %v", tt.input, err)
+		}
+		if got := layerIdentity(ss[0]); got != tt.want {
+			t.Errorf("layerIdentity(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func mergeTestLayers(t *testing.T, showOrigin bool, sources ...string) []string {
+	t.Helper()
+	var layers []statements
+	var names []string
+	for i, src := range sources {
+		ss, err := readINI(strings.NewReader(src), 0)
+		if err != nil {
+			t.Fatalf("readINI error: %v", err)
+		}
+		layers = append(layers, ss)
+		names = append(names, []string{"defaults.ini", "site.ini", "local.ini"}[i])
+	}
+
+	var got []string
+	for _, s := range mergeLayers(layers, names, showOrigin) {
+		got = append(got, statementToString(s))
+	}
+	return got
+}
+
+func TestMergeLayers(t *testing.T) {
+	got := mergeTestLayers(t, false,
+		"[database]\nhost = localhost\nport = 5432\n\n[php]\nextension = curl\nextension = gd\n",
+		"[database]\nport = 6000\nuser = site\n",
+		"[php]\nextension = intl\n\n[local]\ndebug = true\n",
+	)
+	want := []string{
+		`ini = {};`,
+		`ini.database = {};`,
+		`ini.database.host = "localhost";`,
+		`ini.database.port = "6000";`,
+		`ini.php = {};`,
+		`ini.php.extension = "intl";`,
+		`ini.database.user = "site";`,
+		`ini.local = {};`,
+		`ini.local.debug = "true";`,
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("mergeLayers:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMergeLayersShowOrigin(t *testing.T) {
+	got := mergeTestLayers(t, true,
+		"[database]\nhost = localhost\nport = 5432\n",
+		"[database]\nport = 6000\n",
+	)
+	want := []string{
+		`ini = {};`,
+		`ini.database = {};`,
+		`ini.database.host # "defaults.ini";`,
+		`ini.database.host = "localhost";`,
+		`ini.database.port # "site.ini";`,
+		`ini.database.port = "6000";`,
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("mergeLayers:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMergeLayersReplacesAttributes(t *testing.T) {
+	var layers []statements
+	for _, src := range []string{"port: 9 ; c\n", "port = 7\n"} {
+		ss, err := readINI(strings.NewReader(src), optInlineComments)
+		if err != nil {
+			t.Fatalf("readINI error: %v", err)
+		}
+		layers = append(layers, ss)
+	}
+
+	var buf bytes.Buffer
+	if err := ungrinFromStatements(mergeLayers(layers, []string{"l2.ini", "l3.ini"}, false), &buf); err != nil {
+		t.Fatalf("ungrinFromStatements error: %v", err)
+	}
+	if want := "port = 7\n"; buf.String() != want {
+		t.Errorf("merged = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestReadLayers(t *testing.T) {
+	inputs := []namedInput{
+		{name: "a.ini", r: strings.NewReader("key = a\n")},
+		{name: "b.ini", r: strings.NewReader("key = b\n")},
+	}
+	read, opts := inputsReader(readINI, inputs, "ini", optMerge|optWithFilename, nil)
+	if opts&optWithFilename != 0 {
+		t.Error("inputsReader: --merge should not root files at their names")
+	}
+
+	ss, err := read(nil, opts)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if got := statementToString(ss[len(ss)-1]); got != `ini.key = "b";` {
+		t.Errorf("last statement = %q, want %q", got, `ini.key = "b";`)
+	}
+
+	inputs = []namedInput{
+		{name: "a.ini", r: strings.NewReader("key = a\n")},
+		{name: "bad.ini", r: strings.NewReader("[broken\n")},
+	}
+	_, err = readLayers(readINI, inputs)(nil, 0)
+	if err == nil || !strings.HasPrefix(err.Error(), "bad.ini: ") {
+		t.Errorf("readLayers error = %v, want it to name bad.ini", err)
+	}
+}
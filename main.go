@@ -1,11 +1,11 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"sort"
 	"strings"
 
 	"github.com/fatih/color"
@@ -18,17 +18,41 @@ const (
 	exitReadInput       = 2
 	exitFormStatements  = 3
 	exitParseStatements = 5
+	exitInvalidOptions  = 6
+	exitWriteFile       = 7
+	exitDifferent       = 8
+	exitConflict        = 9
 )
 
 const (
 	optMonochrome = 1 << iota
 	optNoSort
+	optComments
+	optWithFilename
+	optMerge
+	optShowOrigin
+	optRecursive
+	optLineNumbers
+	optInlineComments
+	optNormalizeDelimiters
+	optTypes
+	optBackslashContinuations
 )
 
 var grinVersion = "dev"
 
 type actionFn func(io.Reader, io.Writer, int) (int, error)
 
+// commandFn runs a subcommand such as `grin set` with its arguments and
+// the reader that --from and --dialect select.
+type commandFn func([]string, io.Reader, io.Writer, readerFn, int) (int, error)
+
+var commands = map[string]commandFn{
+	"set":   setCommand,
+	"diff":  diffCommand,
+	"merge": mergeCommand,
+}
+
 func main() {
 	var (
 		ungrinFlag     bool
@@ -37,6 +61,26 @@ func main() {
 		noSortFlag     bool
 		versionFlag    bool
 		valuesFlag     bool
+		jsonFlag       bool
+		commentsFlag   bool
+		fromFlag       string
+		toFlag         string
+		patchFlag      string
+		filenameFlag   bool
+		mergeFlag      bool
+		originFlag     bool
+		recursiveFlag  bool
+		includeFlag    patternList
+		lineNumFlag    bool
+		inlineFlag     bool
+		normalizeFlag  bool
+		dialectFlag    string
+		typesFlag      bool
+		backslashFlag  bool
+		shellFlag      bool
+		shellSepFlag   string
+		shellCaseFlag  string
+		shellPrefix    string
 	)
 
 	flag.BoolVar(&ungrinFlag, "ungrin", false, "Reverse the operation (turn assignments back into INI)")
@@ -46,22 +90,71 @@ func main() {
 	flag.BoolVar(&monochromeFlag, "monochrome", false, "Monochrome (don't colorize output)")
 	flag.BoolVar(&monochromeFlag, "m", false, "Monochrome (don't colorize output)")
 	flag.BoolVar(&noSortFlag, "no-sort", false, "Don't sort output (faster)")
+	flag.StringVar(&patchFlag, "patch", "", "Apply assignments from the input to an INI file")
+	flag.BoolVar(&commentsFlag, "comments", false, "Keep INI comments as comment statements")
+	flag.BoolVar(&inlineFlag, "inline-comments", false, "Strip ; and # comments that follow values")
+	flag.BoolVar(&normalizeFlag, "normalize-delimiters", false, "Write every key with = when turning assignments into INI")
+	flag.BoolVar(&typesFlag, "types", false, "Write numbers and booleans as typed values, without quotes")
+	flag.BoolVar(&backslashFlag, "backslash-continuations", false, "Continue INI values after a line ending in a backslash")
+	flag.BoolVar(&filenameFlag, "with-filename", false, "Root each file's assignments at its filename")
+	flag.BoolVar(&filenameFlag, "H", false, "Root each file's assignments at its filename")
+	flag.BoolVar(&mergeFlag, "merge", false, "Merge the input files, later files taking precedence")
+	flag.BoolVar(&originFlag, "show-origin", false, "Annotate merged assignments with the file that set them")
+	flag.BoolVar(&recursiveFlag, "recursive", false, "Read the matching files below each directory")
+	flag.BoolVar(&recursiveFlag, "r", false, "Read the matching files below each directory")
+	flag.Var(&includeFlag, "include", "File name pattern for --recursive (repeatable)")
+	flag.BoolVar(&lineNumFlag, "line-numbers", false, "Follow each assignment with the file and line it came from")
+	flag.BoolVar(&lineNumFlag, "n", false, "Follow each assignment with the file and line it came from")
 	flag.BoolVar(&versionFlag, "version", false, "Print version information")
 	flag.BoolVar(&valuesFlag, "values", false, "Print just the values of provided assignments")
 	flag.BoolVar(&valuesFlag, "v", false, "Print just the values of provided assignments")
+	flag.BoolVar(&jsonFlag, "json", false, "Print the INI as a nested JSON document")
+	flag.BoolVar(&jsonFlag, "j", false, "Print the INI as a nested JSON document")
+	flag.StringVar(&fromFlag, "from", "", "Input format (ini, grin, json, gitconfig, systemd, php, properties, dotenv, toml)")
+	flag.StringVar(&toFlag, "to", "", "Output format (grin, ini, json, values, gitconfig, systemd, php, properties, dotenv, shell, toml, yaml)")
+	flag.BoolVar(&shellFlag, "shell", false, "Print the INI as shell export commands")
+	flag.StringVar(&shellSepFlag, "shell-separator", "_", "Join section names and keys with SEP in --shell names")
+	flag.StringVar(&shellCaseFlag, "shell-case", "upper", "Case of --shell names: upper, lower or keep")
+	flag.StringVar(&shellPrefix, "shell-prefix", "", "Start each --shell name with PREFIX")
+	flag.StringVar(&dialectFlag, "dialect", "", "Read and write INI in dialect NAME (ini, gitconfig, systemd, php)")
 
 	flag.Usage = func() {
 		h := "Transform INI (from a file or stdin) into discrete assignments to make it greppable\n\n"
 
 		h += "Usage:\n"
-		h += "  grin [OPTIONS] [FILE|-]\n\n"
+		h += "  grin [OPTIONS] [FILE|-]...\n"
+		h += "  grin set FILE|- PATH VALUE\n"
+		h += "  grin diff FILE FILE\n"
+		h += "  grin merge BASE OURS THEIRS\n\n"
 
 		h += "Options:\n"
 		h += "  -u, --ungrin     Reverse the operation (turn assignments back into INI)\n"
 		h += "  -v, --values     Print just the values of provided assignments\n"
+		h += "  -j, --json       Print the INI as a nested JSON document\n"
+		h += "      --shell      Print the INI as shell export commands\n"
+		h += "      --shell-separator SEP Join section names and keys with SEP (default _)\n"
+		h += "      --shell-case CASE Case of --shell names: upper (default), lower, keep\n"
+		h += "      --shell-prefix PREFIX Start each --shell name with PREFIX\n"
+		h += "      --from FMT   Input format: ini (default), grin, json, gitconfig, systemd, php,\n"
+		h += "                   properties, dotenv, toml\n"
+		h += "      --to FMT     Output format: grin (default), ini, json, values, gitconfig,\n"
+		h += "                   systemd, php, properties, dotenv, shell, toml, yaml\n"
+		h += "      --dialect NAME Read and write INI in dialect NAME: ini (default), gitconfig, systemd, php\n"
+		h += "      --patch FILE Apply assignments from the input to FILE, keeping its layout\n"
 		h += "  -c, --colorize   Colorize output (default on tty)\n"
 		h += "  -m, --monochrome Monochrome (don't colorize output)\n"
 		h += "      --no-sort    Don't sort output (faster)\n"
+		h += "      --comments   Keep INI comments as comment statements\n"
+		h += "      --inline-comments Strip ; and # comments that follow values\n"
+		h += "      --normalize-delimiters Write every key with = when turning assignments into INI\n"
+		h += "      --types      Write numbers and booleans as typed values, without quotes\n"
+		h += "      --backslash-continuations Continue INI values after a line ending in a backslash\n"
+		h += "  -n, --line-numbers Follow each assignment with the file and line it came from\n"
+		h += "  -H, --with-filename Root each file's assignments at its filename\n"
+		h += "      --merge      Merge the input files, later files taking precedence\n"
+		h += "      --show-origin Annotate merged assignments with the file that set them\n"
+		h += "  -r, --recursive  Read the matching files below each directory\n"
+		h += "      --include GLOB File name pattern for -r (default *.ini, *.conf, *.cfg)\n"
 		h += "      --version    Print version information\n\n"
 
 		h += "Exit Codes:\n"
@@ -69,13 +162,37 @@ func main() {
 		h += "  1\tFailed to open file\n"
 		h += "  2\tFailed to read input\n"
 		h += "  3\tFailed to form statements\n"
-		h += "  5\tFailed to parse statements\n\n"
+		h += "  5\tFailed to parse statements\n"
+		h += "  6\tInvalid options\n"
+		h += "  7\tFailed to write file\n"
+		h += "  8\tFiles differ (diff)\n"
+		h += "  9\tMerge conflicts (merge)\n\n"
 
 		h += "Examples:\n"
 		h += "  grin /etc/config.ini\n"
 		h += "  grin config.ini | grep database\n"
 		h += "  cat config.ini | grin\n"
+		h += "  grin conf.d/*.ini | grep host\n"
+		h += "  grin -r /etc/myapp | grep database\n"
+		h += "  grin -n app.ini | grep port\n"
+		h += "  grin --merge --show-origin defaults.ini site.ini local.ini\n"
 		h += "  grin config.ini | grep host | grin --ungrin\n"
+		h += "  grin --comments config.ini | grep database | grin -u\n"
+		h += "  grin --inline-comments my.cnf | grep port\n"
+		h += "  grin --json config.ini | jq .database\n"
+		h += "  grin --from json --to ini config.json\n"
+		h += "  grin --from gitconfig ~/.gitconfig | grep remote\n"
+		h += "  grin --dialect systemd --merge nginx.service | grep Exec\n"
+		h += "  grin --dialect php php.ini | grep extension\n"
+		h += "  grin --from properties application.properties | grep datasource\n"
+		h += "  grin --to dotenv config.ini > .env\n"
+		h += "  eval \"$(grin --shell app.ini)\"\n"
+		h += "  grin --to toml --types config.ini > config.toml\n"
+		h += "  grin --to yaml config.ini > values.yaml\n"
+		h += "  grin set config.ini ini.database.port 5433\n"
+		h += "  grin --patch base.ini < changes.grin > merged.ini\n"
+		h += "  grin diff deployed.ini desired.ini\n"
+		h += "  grin merge base.ini ours.ini theirs.ini\n"
 
 		fmt.Fprint(os.Stderr, h)
 	}
@@ -87,25 +204,6 @@ func main() {
 		os.Exit(exitOK)
 	}
 
-	// Auto-detect ungrin mode if invoked as "ungrin"
-	if strings.HasSuffix(os.Args[0], "ungrin") {
-		ungrinFlag = true
-	}
-
-	// Determine input source
-	var rawInput io.Reader
-	filename := flag.Arg(0)
-	if filename == "" || filename == "-" {
-		rawInput = os.Stdin
-	} else {
-		f, err := os.Open(filename)
-		if err != nil {
-			fatal(exitOpenFile, err)
-		}
-		defer f.Close() //nolint:errcheck // best-effort close on read-only file
-		rawInput = f
-	}
-
 	// Build options
 	var opts int
 	switch {
@@ -114,83 +212,128 @@ func main() {
 	case monochromeFlag || color.NoColor:
 		opts |= optMonochrome
 	}
-	if noSortFlag {
-		opts |= optNoSort
+	for _, o := range []struct {
+		set bool
+		opt int
+	}{
+		{noSortFlag, optNoSort},
+		{commentsFlag, optComments},
+		{inlineFlag, optInlineComments},
+		{normalizeFlag, optNormalizeDelimiters},
+		{typesFlag, optTypes},
+		{backslashFlag, optBackslashContinuations},
+		{filenameFlag, optWithFilename},
+		{mergeFlag, optMerge},
+		{originFlag, optShowOrigin},
+		{recursiveFlag, optRecursive},
+		{lineNumFlag, optLineNumbers},
+	} {
+		if o.set {
+			opts |= o.opt
+		}
 	}
 
-	// Select action
-	var a actionFn = grinAction
-	if ungrinFlag {
-		a = ungrinAction
-	} else if valuesFlag {
-		a = grinValuesAction
+	// Auto-detect ungrin mode if invoked as "ungrin"
+	if strings.HasSuffix(os.Args[0], "ungrin") {
+		ungrinFlag = true
 	}
 
-	exitCode, err := a(rawInput, colorable.NewColorableStdout(), opts)
-	if exitCode != exitOK {
-		fatal(exitCode, err)
+	// Select action
+	inFmt, outFmt := resolveFormats(fromFlag, toFlag, ungrinFlag, valuesFlag, jsonFlag, shellFlag)
+	inFmt, outFmt, err := applyDialect(inFmt, outFmt, dialectFlag)
+	if err != nil {
+		fatal(exitInvalidOptions, err)
 	}
-	os.Exit(exitOK)
-}
-
-func grinAction(r io.Reader, w io.Writer, opts int) (int, error) {
-	var conv statementconv
-	if opts&optMonochrome > 0 {
-		conv = statementToString
-	} else {
-		conv = statementToColorString
+	read, write, failCode, err := selectShellFormats(inFmt, outFmt, shellSepFlag, shellCaseFlag, shellPrefix)
+	if err != nil {
+		fatal(exitInvalidOptions, err)
 	}
 
-	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(r, prefix)
-	if err != nil {
-		return exitFormStatements, err
+	// Subcommands
+	if cmd, ok := commands[flag.Arg(0)]; ok {
+		finish(cmd(flag.Args()[1:], os.Stdin, colorable.NewColorableStdout(), read, opts))
 	}
 
-	if opts&optNoSort == 0 {
-		sort.Sort(ss)
+	// Determine input sources
+	inputs, err := collectInputs(flag.Args(), includeFlag, os.Stdin, os.Stderr, opts)
+	if err != nil {
+		fatal(exitOpenFile, err)
 	}
+	defer closeInputs(inputs)
+	read, opts = inputsReader(read, inputs, inFmt, opts, os.Stderr)
 
-	for _, s := range ss {
-		if _, err := fmt.Fprintln(w, conv(s)); err != nil {
-			return exitReadInput, err
+	a := formatAction(read, write, failCode)
+	if patchFlag != "" {
+		if len(inputs) > 1 || inputs[0].r == nil {
+			fatal(exitInvalidOptions, errors.New("--patch reads assignments from a single input"))
 		}
+		a = patchAction(patchFlag)
 	}
 
-	return exitOK, nil
+	finish(a(inputs[0].r, colorable.NewColorableStdout(), opts))
+}
+
+func grinAction(r io.Reader, w io.Writer, opts int) (int, error) {
+	return formatAction(readINI, writeGrin, exitFormStatements)(r, w, opts)
 }
 
 func ungrinAction(r io.Reader, w io.Writer, opts int) (int, error) {
-	ss, err := ungrinStatements(r)
-	if err != nil {
-		return exitParseStatements, err
-	}
+	return formatAction(readGrin, writeINI, exitParseStatements)(r, w, opts)
+}
 
-	if err := ungrinFromStatements(ss, w); err != nil {
-		return exitParseStatements, err
-	}
+func grinValuesAction(r io.Reader, w io.Writer, opts int) (int, error) {
+	return formatAction(readINI, writeValues, exitFormStatements)(r, w, opts)
+}
 
-	return exitOK, nil
+func grinJSONAction(r io.Reader, w io.Writer, opts int) (int, error) {
+	return formatAction(readINI, writeJSON, exitFormStatements)(r, w, opts)
 }
 
-func grinValuesAction(r io.Reader, w io.Writer, opts int) (int, error) {
-	prefix := statement{{text: "ini", typ: typBare}}
-	ss, err := statementsFromINI(r, prefix)
-	if err != nil {
-		return exitFormStatements, err
+// resolveFormats works out the input and output formats from the explicit
+// --from/--to flags and the shorthand mode flags. Explicit formats win;
+// of the shorthands, --ungrin wins over the rest.
+func resolveFormats(from, to string, ungrin, values, json, shell bool) (string, string) {
+	inFmt, outFmt := "ini", "grin"
+	switch {
+	case ungrin:
+		inFmt, outFmt = "grin", "ini"
+	case values:
+		outFmt = "values"
+	case json:
+		outFmt = "json"
+	case shell:
+		outFmt = "shell"
+	}
+	if from != "" {
+		inFmt = from
+	}
+	if to != "" {
+		outFmt = to
 	}
+	return inFmt, outFmt
+}
 
-	for _, s := range ss {
-		for _, t := range s {
-			if t.typ == typString {
-				if _, err := fmt.Fprintln(w, unquoteString(t.text)); err != nil {
-					return exitReadInput, err
-				}
-			}
-		}
+// selectShellFormats looks up the formats as selectFormats does, naming the
+// variables of shell output after the --shell-separator, --shell-case and
+// --shell-prefix options.
+func selectShellFormats(from, to, separator, foldName, prefix string) (readerFn, writerFn, int, error) {
+	read, write, failCode, err := selectFormats(from, to)
+	if err != nil || to != "shell" {
+		return read, write, failCode, err
 	}
+	style, err := newShellStyle(separator, foldName, prefix)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return read, shellWriter(style), failCode, nil
+}
 
-	return exitOK, nil
+// finish exits with code, reporting err if there is one.
+func finish(code int, err error) {
+	if err != nil {
+		fatal(code, err)
+	}
+	os.Exit(code)
 }
 
 func fatal(code int, err error) {
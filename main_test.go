@@ -18,6 +18,7 @@ func TestGrinFixtures(t *testing.T) {
 		"quoted",
 		"empty",
 		"complex",
+		"duplicates",
 	}
 
 	for _, name := range fixtures {
@@ -129,6 +130,7 @@ func TestRoundTrip(t *testing.T) {
 		"nested",
 		"quoted",
 		"complex",
+		"duplicates",
 	}
 
 	for _, name := range fixtures {
@@ -253,3 +255,77 @@ func TestGrinFileInput(t *testing.T) {
 		t.Errorf("file input mismatch")
 	}
 }
+
+func TestGrinJSONAction(t *testing.T) {
+	input := `[zebra]
+key = val
+
+[alpha]
+key = val
+`
+	tests := []struct {
+		opts int
+		want string
+	}{
+		{optMonochrome, "{\n  \"alpha\": {\n    \"key\": \"val\"\n  },\n  \"zebra\": {\n    \"key\": \"val\"\n  }\n}\n"},
+		{optMonochrome | optNoSort, "{\n  \"zebra\": {\n    \"key\": \"val\"\n  },\n  \"alpha\": {\n    \"key\": \"val\"\n  }\n}\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		exitCode, err := grinJSONAction(strings.NewReader(input), &buf, tt.opts)
+		if err != nil {
+			t.Fatalf("grinJSONAction error: %v", err)
+		}
+		if exitCode != exitOK {
+			t.Fatalf("grinJSONAction exit code: %d", exitCode)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("grinJSONAction(opts=%d) = %q, want %q", tt.opts, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestGrinJSONActionConflict(t *testing.T) {
+	input := "a = 1\n\n[a]\nb = 2\n"
+	var buf bytes.Buffer
+	exitCode, err := grinJSONAction(strings.NewReader(input), &buf, optMonochrome)
+	if exitCode != exitFormStatements {
+		t.Errorf("expected exit code %d, got %d", exitFormStatements, exitCode)
+	}
+	if err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestCommentsRoundTrip(t *testing.T) {
+	iniData, err := os.ReadFile(filepath.Join("testdata", "comments.ini"))
+	if err != nil {
+		t.Fatalf("failed to read comments.ini: %v", err)
+	}
+
+	var grinBuf bytes.Buffer
+	exitCode, err := grinAction(bytes.NewReader(iniData), &grinBuf, optMonochrome|optComments)
+	if err != nil || exitCode != exitOK {
+		t.Fatalf("grinAction: exit %d, error %v", exitCode, err)
+	}
+
+	// Simulate: grin --comments comments.ini | grep debug | grin -u
+	var filtered strings.Builder
+	for _, line := range strings.Split(grinBuf.String(), "\n") {
+		if strings.Contains(line, "debug") {
+			filtered.WriteString(line + "\n")
+		}
+	}
+
+	var unBuf bytes.Buffer
+	exitCode, err = ungrinAction(strings.NewReader(filtered.String()), &unBuf, optMonochrome)
+	if err != nil || exitCode != exitOK {
+		t.Fatalf("ungrinAction: exit %d, error %v", exitCode, err)
+	}
+
+	want := "[app]\n# Debug mode\ndebug = false\n"
+	if unBuf.String() != want {
+		t.Errorf("filtered round trip = %q, want %q", unBuf.String(), want)
+	}
+}
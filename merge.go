@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Conflict markers, as written by git.
+const (
+	conflictOurs   = "<<<<<<< ours"
+	conflictSep    = "======="
+	conflictTheirs = ">>>>>>> theirs"
+)
+
+// merger carries out a three-way merge by applying their changes, relative
+// to the common base, to our document. Each version maps the path of every
+// assignment, without any index, to its values, so that the occurrences of
+// a repeated key are merged as one list.
+type merger struct {
+	doc    *iniDocument
+	base   map[string][]token
+	ours   map[string][]token
+	theirs map[string][]token
+	// merged holds the paths already merged.
+	merged map[string]bool
+	// implied holds the sections that their keys or subsections create.
+	implied map[string]bool
+	// added and removed hold the sections they added and deleted, which
+	// are only dealt with once every key has been merged.
+	added     []string
+	removed   []string
+	conflicts int
+}
+
+// assignmentValues maps the path of every assignment in ss to its value.
+func assignmentValues(ss statements) map[string]token {
+	values := make(map[string]token)
+	for _, s := range ss {
+		if path, value, ok := splitAssignment(s); ok {
+			values[statementToString(path)] = value
+		}
+	}
+	return values
+}
+
+// listValues maps the path of every assignment in ss, without any index,
+// to the values assigned to it in order, so that x[0] and x[1] are the
+// values of x.
+func listValues(ss statements) map[string][]token {
+	values := make(map[string][]token)
+	for _, s := range ss {
+		if path, value, ok := splitAssignment(s); ok {
+			id := statementToString(withoutIndex(path))
+			values[id] = append(values[id], value)
+		}
+	}
+	return values
+}
+
+// sameValues reports whether a and b hold the same values in the same
+// order.
+func sameValues(a, b []token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].text != b[i].text {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeINI merges theirs into doc, which holds ours, given the base
+// version both were derived from. A key changed on only one side takes
+// that side's value; a key changed differently on both is a conflict and
+// is written between conflict markers. A repeated key is changed when any
+// of its values is, so it is taken whole from one side or is a conflict.
+// It returns the number of conflicts.
+func mergeINI(doc *iniDocument, base, ours, theirs statements) (int, error) {
+	m := &merger{
+		doc:     doc,
+		base:    listValues(base),
+		ours:    listValues(ours),
+		theirs:  listValues(theirs),
+		merged:  make(map[string]bool),
+		implied: impliedSections(theirs),
+	}
+
+	for _, s := range theirs {
+		if err := m.merge(s); err != nil {
+			return 0, err
+		}
+	}
+	// Keys they deleted
+	for _, s := range base {
+		if err := m.merge(s); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, name := range m.added {
+		if !m.implied[name] && !doc.hasSection(name) {
+			doc.appendSection(name)
+		}
+	}
+	for _, name := range m.removed {
+		doc.removeSection(name)
+	}
+	return m.conflicts, nil
+}
+
+// merge resolves the path assigned by s, which is taken from their version
+// if they have it and from the base version otherwise, unless it has been
+// merged already.
+func (m *merger) merge(s statement) error {
+	path, _, ok := splitAssignment(s)
+	if !ok {
+		return nil
+	}
+	key := statementToString(withoutIndex(path))
+	if m.merged[key] {
+		return nil
+	}
+	m.merged[key] = true
+	b, o, t := m.base[key], m.ours[key], m.theirs[key]
+
+	switch {
+	case sameValues(o, t), sameValues(b, t):
+		// Both made the same change, or only we changed it
+		return nil
+	case sameValues(b, o):
+		return m.take(s, t)
+	default:
+		m.conflict(s, t)
+		return nil
+	}
+}
+
+// take applies their version of the path assigned by s: values, or a
+// deletion if there are none.
+func (m *merger) take(s statement, values []token) error {
+	target, ok := targetFromStatement(s)
+	if !ok {
+		return nil
+	}
+
+	_, v, _ := splitAssignment(s)
+	if v.typ == typEmptyObject {
+		name := joinSection(target.section, target.key)
+		if len(values) > 0 {
+			m.added = append(m.added, name)
+		} else {
+			m.removed = append(m.removed, name)
+		}
+		return nil
+	}
+
+	m.doc.setValues(target.section, target.key, unquoteValues(values))
+	return nil
+}
+
+// unquoteValues returns the unquoted text of each of values.
+func unquoteValues(values []token) []string {
+	texts := make([]string, len(values))
+	for i, v := range values {
+		texts[i] = unquoteString(v.text)
+	}
+	return texts
+}
+
+// conflict gathers our lines for the key assigned by s where its first
+// occurrence is, and surrounds them with conflict markers, adding their
+// values (if they kept the key) below ours. Sections never conflict, as
+// every section has the same value.
+func (m *merger) conflict(s statement, values []token) {
+	target, _ := targetFromStatement(s)
+	section := target.section
+	m.conflicts++
+
+	found := m.doc.keyLines(section, target.key)
+	var ours, theirs []iniLine
+	switch {
+	case len(found) > 0:
+		for _, at := range found {
+			ours = append(ours, m.doc.lines[at:m.doc.valueEnd(at)]...)
+		}
+		for _, value := range unquoteValues(values) {
+			theirs = append(theirs, keyValueLines(m.doc.lines[found[0]], value)...)
+		}
+	default:
+		// We deleted the key: put their lines where they would be added
+		m.doc.setValues(section, target.key, unquoteValues(values))
+		found = m.doc.keyLines(section, target.key)
+		for _, at := range found {
+			theirs = append(theirs, m.doc.lines[at:m.doc.valueEnd(at)]...)
+		}
+	}
+	// Their lines are text only, so that ours stay the ones found by key
+	for i := range theirs {
+		theirs[i] = iniLine{text: theirs[i].text, section: section}
+	}
+
+	block := []iniLine{{text: conflictOurs, section: section}}
+	block = append(block, ours...)
+	block = append(block, iniLine{text: conflictSep, section: section})
+	block = append(block, theirs...)
+	block = append(block, iniLine{text: conflictTheirs, section: section})
+
+	at := found[0]
+	for i := len(found) - 1; i >= 0; i-- {
+		m.doc.lines = append(m.doc.lines[:found[i]], m.doc.lines[m.doc.valueEnd(found[i]):]...)
+	}
+	m.doc.insertLines(at, block...)
+}
+
+// joinSection returns the name of the section key within section.
+func joinSection(section, key string) string {
+	if section == "" {
+		return key
+	}
+	return section + "." + key
+}
+
+// mergeCommand implements `grin merge BASE OURS THEIRS`: it merges the
+// changes made between BASE and THEIRS into OURS, key by key, and rewrites
+// OURS with the result. This is the contract of a git merge driver:
+//
+//	[merge "grin"]
+//		driver = grin merge %O %A %B
+//
+// Conflicting changes are written between conflict markers and reported
+// with a nonzero exit code.
+func mergeCommand(args []string, stdin io.Reader, w io.Writer, _ readerFn, opts int) (int, error) {
+	if len(args) != 3 {
+		return exitInvalidOptions, errors.New("usage: grin merge BASE OURS THEIRS")
+	}
+
+	var versions [3]statements
+	var src []byte
+	for i, filename := range args {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return exitOpenFile, err
+		}
+		ss, err := readINI(bytes.NewReader(data), opts&(optBackslashContinuations|optInlineComments))
+		if err != nil {
+			return exitFormStatements, fmt.Errorf("%s: %w", filename, err)
+		}
+		versions[i] = ss
+		if i == 1 {
+			src = data
+		}
+	}
+
+	doc, err := parseINIDocument(string(src), opts)
+	if err != nil {
+		return exitFormStatements, err
+	}
+
+	conflicts, err := mergeINI(doc, versions[0], versions[1], versions[2])
+	if err != nil {
+		return exitFormStatements, err
+	}
+	if err := replaceFile(args[1], doc.String()); err != nil {
+		return exitWriteFile, err
+	}
+
+	if conflicts > 0 {
+		noun := "conflicts"
+		if conflicts == 1 {
+			noun = "conflict"
+		}
+		return exitConflict, fmt.Errorf("%s: %d %s", args[1], conflicts, noun)
+	}
+	return exitOK, nil
+}
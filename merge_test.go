@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const mergeBase = `; shared settings
+name = app
+
+[database]
+host = localhost
+port = 5432
+
+[cache]
+ttl = 60
+
+[old]
+x = 1
+`
+
+func runMerge(t *testing.T, base, ours, theirs string) (string, int) {
+	t.Helper()
+	var versions []statements
+	for _, src := range []string{base, ours, theirs} {
+		ss, err := readINI(strings.NewReader(src), 0)
+		if err != nil {
+			t.Fatalf("readINI error: %v", err)
+		}
+		versions = append(versions, ss)
+	}
+	doc, err := parseINIDocument(ours, 0)
+	if err != nil {
+		t.Fatalf("parseINIDocument error: %v", err)
+	}
+	conflicts, err := mergeINI(doc, versions[0], versions[1], versions[2])
+	if err != nil {
+		t.Fatalf("mergeINI error: %v", err)
+	}
+	return doc.String(), conflicts
+}
+
+func TestMergeINIClean(t *testing.T) {
+	ours := strings.Replace(mergeBase, "host = localhost", "host = db", 1)
+	theirs := strings.Replace(mergeBase, "port = 5432", "port = 6000", 1)
+	theirs = strings.Replace(theirs, "\n[old]\nx = 1\n", "", 1)
+	theirs += "\n[new]\nk = v\n"
+
+	got, conflicts := runMerge(t, mergeBase, ours, theirs)
+	if conflicts != 0 {
+		t.Errorf("conflicts = %d, want 0", conflicts)
+	}
+
+	want := `; shared settings
+name = app
+
+[database]
+host = db
+port = 6000
+
+[cache]
+ttl = 60
+
+[new]
+k = v
+`
+	if got != want {
+		t.Errorf("merged:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMergeINISameChange(t *testing.T) {
+	changed := strings.Replace(mergeBase, "ttl = 60", "ttl = 90", 1)
+	got, conflicts := runMerge(t, mergeBase, changed, changed)
+	if conflicts != 0 {
+		t.Errorf("conflicts = %d, want 0", conflicts)
+	}
+	if got != changed {
+		t.Errorf("merged:\n%s\nwant:\n%s", got, changed)
+	}
+}
+
+func TestMergeINIConflicts(t *testing.T) {
+	ours := strings.Replace(mergeBase, "ttl = 60", "ttl = 90", 1)
+	ours = strings.Replace(ours, "port = 5432\n", "", 1)
+	theirs := strings.Replace(mergeBase, "ttl = 60", "ttl = 120", 1)
+	theirs = strings.Replace(theirs, "port = 5432", "port = 6000", 1)
+
+	got, conflicts := runMerge(t, mergeBase, ours, theirs)
+	if conflicts != 2 {
+		t.Errorf("conflicts = %d, want 2", conflicts)
+	}
+
+	want := `; shared settings
+name = app
+
+[database]
+host = localhost
+<<<<<<< ours
+=======
+port = 6000
+>>>>>>> theirs
+
+[cache]
+<<<<<<< ours
+ttl = 90
+=======
+ttl = 120
+>>>>>>> theirs
+
+[old]
+x = 1
+`
+	if got != want {
+		t.Errorf("merged:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMergeINIRepeatedKeys(t *testing.T) {
+	base := "[a]\nx = 1\ny = 1\n"
+
+	// They add a second x: ours keeps the first
+	got, conflicts := runMerge(t, base, base, base+"x = 2\n")
+	if conflicts != 0 {
+		t.Errorf("conflicts = %d, want 0", conflicts)
+	}
+	if want := "[a]\nx = 1\nx = 2\ny = 1\n"; got != want {
+		t.Errorf("merged = %q, want %q", got, want)
+	}
+
+	// We changed x and they added to it: neither list wins
+	ours := "[a]\nx = 3\ny = 1\n"
+	got, conflicts = runMerge(t, base, ours, base+"x = 2\n")
+	if conflicts != 1 {
+		t.Errorf("conflicts = %d, want 1", conflicts)
+	}
+	if want := "[a]\n<<<<<<< ours\nx = 3\n=======\nx = 1\nx = 2\n>>>>>>> theirs\ny = 1\n"; got != want {
+		t.Errorf("merged = %q, want %q", got, want)
+	}
+
+	// They dropped one of our repeated values
+	base = "[a]\nx = 1\ny = 1\nx = 2\n"
+	got, conflicts = runMerge(t, base, base, "[a]\nx = 1\ny = 1\n")
+	if conflicts != 0 {
+		t.Errorf("conflicts = %d, want 0", conflicts)
+	}
+	if want := "[a]\nx = 1\ny = 1\n"; got != want {
+		t.Errorf("merged = %q, want %q", got, want)
+	}
+}
+
+func TestMergeCommandInlineComments(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatalf("WriteFile error: %v", err)
+		}
+		return filename
+	}
+	base := write("base.ini", "[db]\nport = 5432 ; default\n")
+	ours := write("ours.ini", "[db]\nport = 5432 ; default\n")
+	theirs := write("theirs.ini", "[db]\nport = 5433 # changed\n")
+
+	var buf bytes.Buffer
+	exitCode, err := mergeCommand([]string{base, ours, theirs}, nil, &buf, nil, optInlineComments)
+	if err != nil {
+		t.Fatalf("mergeCommand error: %v", err)
+	}
+	if exitCode != exitOK {
+		t.Errorf("mergeCommand exit code = %d, want %d", exitCode, exitOK)
+	}
+	got, err := os.ReadFile(ours)
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	if want := "[db]\nport = 5433 ; default\n"; string(got) != want {
+		t.Errorf("merged file = %q, want %q", got, want)
+	}
+}
+
+func TestMergeCommand(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatalf("WriteFile error: %v", err)
+		}
+		return filename
+	}
+	base := write("base.ini", "[a]\nx = 1\ny = 1\n")
+	ours := write("ours.ini", "[a]\nx = 2\ny = 1\n")
+	theirs := write("theirs.ini", "[a]\nx = 1\ny = 2\n")
+
+	var buf bytes.Buffer
+	exitCode, err := mergeCommand([]string{base, ours, theirs}, nil, &buf, nil, 0)
+	if err != nil {
+		t.Fatalf("mergeCommand error: %v", err)
+	}
+	if exitCode != exitOK {
+		t.Errorf("mergeCommand exit code = %d, want %d", exitCode, exitOK)
+	}
+	got, err := os.ReadFile(ours)
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	if want := "[a]\nx = 2\ny = 2\n"; string(got) != want {
+		t.Errorf("merged file = %q, want %q", got, want)
+	}
+
+	// Now both sides have changed y
+	theirs = write("theirs.ini", "[a]\nx = 1\ny = 3\n")
+	exitCode, err = mergeCommand([]string{base, ours, theirs}, nil, &buf, nil, 0)
+	if err == nil {
+		t.Error("mergeCommand: expected a conflict error, got nil")
+	}
+	if exitCode != exitConflict {
+		t.Errorf("mergeCommand exit code = %d, want %d", exitCode, exitConflict)
+	}
+	got, err = os.ReadFile(ours)
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	if want := "[a]\nx = 2\n<<<<<<< ours\ny = 2\n=======\ny = 3\n>>>>>>> theirs\n"; string(got) != want {
+		t.Errorf("merged file = %q, want %q", got, want)
+	}
+}
+
+func TestMergeCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.ini")
+	bad := filepath.Join(dir, "bad.ini")
+	if err := os.WriteFile(good, []byte("key = value\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	if err := os.WriteFile(bad, []byte("[broken\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{good, good}, exitInvalidOptions},
+		{[]string{good, filepath.Join(dir, "missing.ini"), good}, exitOpenFile},
+		{[]string{good, good, bad}, exitFormStatements},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		exitCode, err := mergeCommand(tt.args, nil, &buf, nil, 0)
+		if err == nil {
+			t.Errorf("mergeCommand(%q): expected error, got nil", tt.args)
+		}
+		if exitCode != tt.want {
+			t.Errorf("mergeCommand(%q): exit code = %d, want %d", tt.args, exitCode, tt.want)
+		}
+	}
+}
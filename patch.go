@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// patchAction returns an action that reads grin statements and applies
+// them to the INI file base, writing the patched file. Lines the
+// statements don't touch are reproduced exactly.
+func patchAction(base string) actionFn {
+	return func(r io.Reader, w io.Writer, opts int) (int, error) {
+		src, err := os.ReadFile(base)
+		if err != nil {
+			return exitOpenFile, err
+		}
+		doc, err := parseINIDocument(string(src), opts)
+		if err != nil {
+			return exitFormStatements, err
+		}
+
+		ss, err := ungrinStatements(r)
+		if err != nil {
+			return exitParseStatements, err
+		}
+		if err := applyPatch(doc, ss); err != nil {
+			return exitFormStatements, err
+		}
+
+		if _, err := io.WriteString(w, doc.String()); err != nil {
+			return exitReadInput, err
+		}
+		return exitOK, nil
+	}
+}
+
+// applyPatch sets every value assigned by ss in doc. Empty-object
+// statements add a section only when nothing else in the patch or the
+// document already implies it, so that the parent objects grin emits for
+// nested sections don't turn into stray headers.
+func applyPatch(doc *iniDocument, ss statements) error {
+	implied := impliedSections(ss)
+	var objects []string
+
+	for _, s := range ss {
+		path, value, isObj := extractPathAndValue(s)
+		if len(path) == 0 {
+			continue
+		}
+		if isObj {
+			objects = append(objects, strings.Join(path, "."))
+			continue
+		}
+
+		t, _ := targetFromStatement(s)
+		if err := doc.set(t.section, t.key, t.index, value); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range objects {
+		if !implied[name] && !doc.hasSection(name) {
+			doc.appendSection(name)
+		}
+	}
+	return nil
+}
+
+// impliedSections returns the names of the objects that have keys or
+// sections below them in ss, and so need no header of their own.
+func impliedSections(ss statements) map[string]bool {
+	implied := make(map[string]bool)
+	for _, s := range ss {
+		path, _, _ := extractPathAndValue(s)
+		for i := 1; i < len(path); i++ {
+			implied[strings.Join(path[:i], ".")] = true
+		}
+	}
+	return implied
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	base := `; Complex configuration example
+app-name = SuperApp
+version = 2.1
+
+[database]
+host = db.example.com
+port = 5432
+
+[database.pool]
+min = 5
+max = 20
+`
+	patch := `ini = {};
+ini.database = {};
+ini.database.port = "6000";
+ini.database.pool = {};
+ini.database.pool.idle = "3";
+ini.empty = {};
+ini.cache = {};
+ini.cache.ttl = "60";
+ini.version = "3.0";
+`
+	want := `; Complex configuration example
+app-name = SuperApp
+version = 3.0
+
+[database]
+host = db.example.com
+port = 6000
+
+[database.pool]
+min = 5
+max = 20
+idle = 3
+
+[cache]
+ttl = 60
+
+[empty]
+`
+	doc, err := parseINIDocument(base, 0)
+	if err != nil {
+		t.Fatalf("parseINIDocument error: %v", err)
+	}
+	ss, err := ungrinStatements(strings.NewReader(patch))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+	if err := applyPatch(doc, ss); err != nil {
+		t.Fatalf("applyPatch error: %v", err)
+	}
+
+	if got := doc.String(); got != want {
+		t.Errorf("patched output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestApplyPatchOwnOutputIsNoOp(t *testing.T) {
+	// Patching a file with its own grin output must not change it, even
+	// though grin emits parent objects that have no header of their own.
+	base, err := os.ReadFile(filepath.Join("testdata", "nested.ini"))
+	if err != nil {
+		t.Fatalf("failed to read nested.ini: %v", err)
+	}
+	patch, err := os.ReadFile(filepath.Join("testdata", "nested.grin"))
+	if err != nil {
+		t.Fatalf("failed to read nested.grin: %v", err)
+	}
+
+	doc, err := parseINIDocument(string(base), 0)
+	if err != nil {
+		t.Fatalf("parseINIDocument error: %v", err)
+	}
+	ss, err := ungrinStatements(bytes.NewReader(patch))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+	if err := applyPatch(doc, ss); err != nil {
+		t.Fatalf("applyPatch error: %v", err)
+	}
+
+	if got := doc.String(); got != string(base) {
+		t.Errorf("patched output:\n%s\nwant:\n%s", got, base)
+	}
+}
+
+func TestPatchAction(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "base.ini")
+	if err := os.WriteFile(filename, []byte("[app]\n; keep me\nname = old\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	exitCode, err := patchAction(filename)(strings.NewReader(`ini.app.name = "new";`), &buf, optMonochrome)
+	if err != nil {
+		t.Fatalf("patchAction error: %v", err)
+	}
+	if exitCode != exitOK {
+		t.Fatalf("patchAction exit code: %d", exitCode)
+	}
+
+	want := "[app]\n; keep me\nname = new\n"
+	if buf.String() != want {
+		t.Errorf("patchAction output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPatchActionErrors(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.ini")
+	bad := filepath.Join(dir, "bad.ini")
+	if err := os.WriteFile(good, []byte("[s]\nk = 1\nk = 2\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	if err := os.WriteFile(bad, []byte("[broken\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	tests := []struct {
+		base  string
+		input string
+		want  int
+	}{
+		{filepath.Join(dir, "missing.ini"), "", exitOpenFile},
+		{bad, "", exitFormStatements},
+		{good, "not grin", exitParseStatements},
+		{good, `ini.s.k = "3";`, exitFormStatements},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		exitCode, err := patchAction(tt.base)(strings.NewReader(tt.input), &buf, optMonochrome)
+		if err == nil {
+			t.Errorf("patchAction(%q, %q): expected error, got nil", tt.base, tt.input)
+		}
+		if exitCode != tt.want {
+			t.Errorf("patchAction(%q, %q): exit code = %d, want %d", tt.base, tt.input, exitCode, tt.want)
+		}
+	}
+}
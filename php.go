@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// phpReader holds the state of reading a php.ini file.
+type phpReader struct {
+	data           iniData
+	section        string
+	pendingComment []string
+	// open is a key whose quoted value continues on the next line, and
+	// text holds the lines of its value read so far.
+	open *iniKVPair
+	text string
+}
+
+// statementsFromPHP reads a php.ini file from r and produces grin
+// statements rooted at prefix, one path component per section, as in
+// ini.Session["session.name"]. Names are case-sensitive. A key such as
+// extension[] adds an element to a list, given an index and marked by an
+// array attribute of "append", as does a plain key assigned more than
+// once; the two forms share one list. key[name] sets the element name,
+// given as a path component below the key and marked by an array
+// attribute of "offset", and replaces it if it is set again. Quoted values are unquoted, with the quote
+// kept as an attribute; constants, expressions and ${VAR} references are
+// kept as they were written.
+func statementsFromPHP(r io.Reader, prefix statement, opts int) (statements, error) {
+	p := &phpReader{
+		data: iniData{
+			sectionKeys:     make(map[string][]iniKVPair),
+			sectionComments: make(map[string]string),
+			sectionLines:    make(map[string]int),
+			sectionPath: func(prefix statement, name string) []statement {
+				return []statement{prefix.withKey(name)}
+			},
+		},
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if lineNum == 1 {
+			line = stripBOM(line)
+		}
+		if err := p.readLine(line, lineNum); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+	if p.open != nil {
+		return nil, fmt.Errorf("line %d: unterminated quoted value", p.open.line)
+	}
+	p.data.trailingComment = strings.Join(p.pendingComment, "\n")
+
+	return buildINIStatements(prefix, &p.data, opts), nil
+}
+
+// readLine reads one line of the file: a comment, a section header, a key,
+// or the continuation of a quoted value.
+func (p *phpReader) readLine(line string, lineNum int) error {
+	if p.open != nil {
+		p.addValue(p.text + "\n" + line)
+		return nil
+	}
+
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case trimmed == "":
+		return nil
+	case trimmed[0] == ';':
+		p.pendingComment = append(p.pendingComment, trimmed)
+		return nil
+	case trimmed[0] == '[':
+		name, err := parseSectionHeader(trimmed, lineNum)
+		if err != nil {
+			return err
+		}
+		p.section = name
+		p.data.addSection(name, p.takeComment(), lineNum)
+		return nil
+	}
+
+	key, text, ok := strings.Cut(trimmed, "=")
+	if !ok {
+		return fmt.Errorf("line %d: expected key = value, got %q", lineNum, trimmed)
+	}
+	pair, err := parsePHPKey(strings.TrimSpace(key), lineNum)
+	if err != nil {
+		return err
+	}
+	pair.comment, pair.line, pair.delimiter = p.takeComment(), lineNum, "="
+	p.open = &pair
+	p.addValue(strings.TrimLeft(text, " \t"))
+	return nil
+}
+
+// takeComment returns the comment lines read since the last section or key.
+func (p *phpReader) takeComment() string {
+	comment := strings.Join(p.pendingComment, "\n")
+	p.pendingComment = nil
+	return comment
+}
+
+// addValue parses text as the value of the open key, recording the key
+// unless a quoted string in text continues on the next line.
+func (p *phpReader) addValue(text string) {
+	value, quote, comment, closed := parsePHPValue(text)
+	if !closed {
+		p.text = text
+		return
+	}
+	pair := *p.open
+	p.open, p.text = nil, ""
+	pair.value, pair.quote, pair.inlineComment = value, quote, comment
+	p.addKey(pair)
+}
+
+// addKey records pair in the current section. A key[name] assigned again
+// replaces the earlier value, while each key[] and each repeated plain
+// key adds an element, as every extension= line loads an extension.
+func (p *phpReader) addKey(pair iniKVPair) {
+	if pair.array && pair.offset != "" {
+		p.data.setKey(p.section, pair)
+		return
+	}
+	p.data.addKey(p.section, pair)
+}
+
+// parsePHPKey parses the name of a key, which may be followed by an array
+// offset in brackets: empty, as in extension[], or a name, as in
+// key[name], that may be quoted.
+func parsePHPKey(key string, lineNum int) (iniKVPair, error) {
+	open := strings.IndexByte(key, '[')
+	if open == -1 {
+		if key == "" {
+			return iniKVPair{}, fmt.Errorf("line %d: empty key", lineNum)
+		}
+		return iniKVPair{key: key}, nil
+	}
+	if open == 0 || !strings.HasSuffix(key, "]") {
+		return iniKVPair{}, fmt.Errorf("line %d: invalid array key %q", lineNum, key)
+	}
+	offset := stripINIQuotes(strings.TrimSpace(key[open+1 : len(key)-1]))
+	return iniKVPair{key: strings.TrimSpace(key[:open]), array: true, offset: offset, appended: offset == ""}, nil
+}
+
+// parsePHPValue parses the text after the '=' of a key line. A value in
+// double quotes has its \" and \\ escapes decoded, and one in single
+// quotes is taken as it is; quote names the quote character of either.
+// Any other value, such as a constant, an expression like
+// E_ALL & ~E_NOTICE or a ${VAR} reference, is kept as it was written, up
+// to the ';' that starts a comment. closed is false if a quoted string in
+// text continues on the next line.
+func parsePHPValue(text string) (value, quote, comment string, closed bool) {
+	end, closed := phpValueEnd(text)
+	if !closed {
+		return "", "", "", false
+	}
+	value, comment = strings.TrimSpace(text[:end]), strings.TrimSpace(text[end:])
+	if value == "" || (value[0] != '"' && value[0] != '\'') || phpStringEnd(value) != len(value)-1 {
+		return value, "", comment, true
+	}
+
+	quote, value = value[:1], value[1:len(value)-1]
+	if quote == `"` {
+		value = unescapePHP(value)
+	}
+	return value, quote, comment, true
+}
+
+// phpValueEnd returns the position of the ';' that starts a comment in
+// text, outside of quotes, or the length of text if there is none. ok is
+// false if a quoted string is not closed.
+func phpValueEnd(text string) (end int, ok bool) {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			n := phpStringEnd(text[i:])
+			if n < 0 {
+				return 0, false
+			}
+			i += n
+		case ';':
+			return i, true
+		}
+	}
+	return len(text), true
+}
+
+// phpStringEnd returns the position of the quote that closes the string
+// s starts with, or -1 if it is not closed. A backslash escapes the
+// character after it in double quotes, but not in single quotes.
+func phpStringEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[0] == '"' && s[i] == '\\':
+			i++
+		case s[i] == s[0]:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapePHP decodes the \" and \\ escapes of a double-quoted value.
+// PHP keeps a backslash before any other character, as in \$.
+func unescapePHP(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// escapePHP escapes s for double quotes, so that unescapePHP returns it.
+func escapePHP(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			b.WriteString(`\"`)
+		case s[i] == '\\' && (i+1 == len(s) || s[i+1] == '"' || s[i+1] == '\\'):
+			b.WriteString(`\\`)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// phpKey is a key to write in a php.ini section. offset is set for an
+// element of a key[name] array, named by the last component of the key's
+// path.
+type phpKey struct {
+	kv     ungrinKVPair
+	offset bool
+}
+
+// phpFromStatements writes statements as a php.ini file. The first
+// component of a path below the root is its section, and the last
+// component of a key marked with an array attribute of "offset" is the
+// name of an element of the array key before it, written key[name]; a key
+// without the attribute is such an element if its path has three
+// components. Each element of a key with indexes is written key[] if it
+// is marked with an array attribute of "append", and as a repeated plain
+// key otherwise. Values
+// are written in the quotes recorded for them; others are written bare,
+// as constants are, unless they would not read back the same.
+func phpFromStatements(ss statements, w io.Writer) error {
+	globalKeys, sections, sectionOrder, emptyOnlySections := indexStatements(ss)
+	comments, sectionComments := indexComments(ss)
+	attrs, _ := indexAttributes(ss)
+	order, keys, err := phpSections(globalKeys, sectionOrder, sections, emptyOnlySections, attrs)
+	if err != nil {
+		return err
+	}
+
+	first := true
+	for _, k := range keys[""] {
+		if err := writePHPKey(w, k, comments, attrs); err != nil {
+			return err
+		}
+		first = false
+	}
+
+	for _, name := range order {
+		if !first {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		first = false
+		if err := writeComment(w, sectionComments[name]); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "[%s]\n", name); err != nil {
+			return err
+		}
+		for _, k := range keys[name] {
+			if err := writePHPKey(w, k, comments, attrs); err != nil {
+				return err
+			}
+		}
+	}
+	return writeComment(w, sectionComments[""])
+}
+
+// phpSections gathers the keys indexStatements found into the php.ini
+// sections they belong to, in the order each was first seen, with the
+// global keys under "". The elements of key[name] arrays are in sections
+// of their own there.
+func phpSections(globalKeys []ungrinKVPair, sectionOrder []string, sections map[string][]ungrinKVPair, emptyOnlySections map[string]bool, attrs map[string]map[string]string) ([]string, map[string][]phpKey, error) {
+	var order []string
+	keys := make(map[string][]phpKey)
+	add := func(name string) {
+		if _, seen := keys[name]; !seen {
+			order = append(order, name)
+			keys[name] = nil
+		}
+	}
+	place := func(kv ungrinKVPair) error {
+		offset := len(kv.path) == 3
+		if array, ok := attrs[kv.commentKey()]["array"]; ok {
+			offset = array == "offset" && len(kv.path) > 1
+		}
+		section := kv.path[:len(kv.path)-1]
+		if offset {
+			section = section[:len(section)-1]
+		}
+		switch len(section) {
+		case 0:
+			keys[""] = append(keys[""], phpKey{kv: kv, offset: offset})
+		case 1:
+			add(section[0])
+			keys[section[0]] = append(keys[section[0]], phpKey{kv: kv, offset: offset})
+		default:
+			return fmt.Errorf("key %q is nested too deeply for php.ini", strings.Join(kv.path, "."))
+		}
+		return nil
+	}
+
+	for _, kv := range globalKeys {
+		if err := place(kv); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, group := range sectionOrder {
+		if emptyOnlySections[group] {
+			add(group)
+		}
+		for _, kv := range sections[group] {
+			if err := place(kv); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return order, keys, nil
+}
+
+// writePHPKey writes the key line of k, preceded by its comment and
+// followed by its inline comment.
+func writePHPKey(w io.Writer, k phpKey, comments map[string]string, attrs map[string]map[string]string) error {
+	if err := checkINIKey(k.kv.key); err != nil {
+		return err
+	}
+	id := k.kv.commentKey()
+	if err := writeComment(w, comments[id]); err != nil {
+		return err
+	}
+
+	name := k.kv.key
+	if k.offset {
+		name = k.kv.path[len(k.kv.path)-2] + "[" + phpOffset(k.kv.key) + "]"
+	}
+	if k.kv.index >= 0 && attrs[id]["array"] == "append" {
+		name += "[]"
+	}
+	line := name + " ="
+	if value := formatPHPValue(k.kv.value, attrs[id]["quote"]); value != "" {
+		line += " " + value
+	}
+	if comment := attrs[id]["comment"]; comment != "" {
+		line += " " + comment
+	}
+	_, err := fmt.Fprintln(w, line)
+	return err
+}
+
+// phpOffset returns the offset of an array key for its brackets, quoted
+// if it has spaces or a closing bracket.
+func phpOffset(name string) string {
+	if strings.ContainsAny(name, " \t]") {
+		return `"` + name + `"`
+	}
+	return name
+}
+
+// formatPHPValue writes value in the quotes it was read in. A value read
+// without them is written bare, unless it has characters that would not
+// read back the same, when it is double-quoted.
+func formatPHPValue(value, quote string) string {
+	switch {
+	case quote == "'" && !strings.Contains(value, "'"):
+		return "'" + value + "'"
+	case quote == "" && !strings.ContainsAny(value, "\"';=\n") && strings.TrimSpace(value) == value:
+		return value
+	}
+	return `"` + escapePHP(value) + `"`
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const phpINI = `; PHP settings
+[PHP]
+engine = On
+error_reporting = E_ALL & ~E_DEPRECATED ; everything
+include_path = ".:/usr/share/php"
+extension[] = gd
+extension[] = "intl"
+sendmail_path = '/usr/sbin/sendmail -t -i'
+user_dir = ${HOME}/public_html
+memory_limit = 128M
+memory_limit = 256M
+opcache[jit] = tracing
+opcache["buffer size"] = 64
+motd = "Welcome,
+say \"hi\" \$x"
+
+[Date]
+date.timezone = "Europe/Berlin"
+
+[mail function]
+SMTP = localhost
+`
+
+func TestStatementsFromPHP(t *testing.T) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromPHP(strings.NewReader(phpINI), prefix, optComments)
+	if err != nil {
+		t.Fatalf("statementsFromPHP error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.PHP # "; PHP settings";`,
+		`ini.PHP = {};`,
+		`ini.PHP.engine = "On";`,
+		`ini.PHP.error_reporting = "E_ALL & ~E_DEPRECATED";`,
+		`ini.PHP.error_reporting@comment = "; everything";`,
+		`ini.PHP.include_path = ".:/usr/share/php";`,
+		`ini.PHP.include_path@quote = "\"";`,
+		`ini.PHP.extension[0] = "gd";`,
+		`ini.PHP.extension[0]@array = "append";`,
+		`ini.PHP.extension[1] = "intl";`,
+		`ini.PHP.extension[1]@quote = "\"";`,
+		`ini.PHP.extension[1]@array = "append";`,
+		`ini.PHP.sendmail_path = "/usr/sbin/sendmail -t -i";`,
+		`ini.PHP.sendmail_path@quote = "'";`,
+		`ini.PHP.user_dir = "${HOME}/public_html";`,
+		`ini.PHP.memory_limit[0] = "128M";`,
+		`ini.PHP.memory_limit[1] = "256M";`,
+		`ini.PHP.opcache.jit = "tracing";`,
+		`ini.PHP.opcache.jit@array = "offset";`,
+		`ini.PHP.opcache["buffer size"] = "64";`,
+		`ini.PHP.opcache["buffer size"]@array = "offset";`,
+		`ini.PHP.motd = "Welcome,\nsay \"hi\" \\$x";`,
+		`ini.PHP.motd@quote = "\"";`,
+		`ini.Date = {};`,
+		`ini.Date["date.timezone"] = "Europe/Berlin";`,
+		`ini.Date["date.timezone"]@quote = "\"";`,
+		`ini["mail function"] = {};`,
+		`ini["mail function"].SMTP = "localhost";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestStatementsFromPHPSingleArrayElement(t *testing.T) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromPHP(strings.NewReader("extension[] = gd\n"), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromPHP error: %v", err)
+	}
+	if got := statementToString(ss[len(ss)-2]); got != `ini.extension[0] = "gd";` {
+		t.Errorf("got %q, want an indexed element", got)
+	}
+}
+
+func TestStatementsFromPHPErrors(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{"missing equals", "[PHP]\nengine\n"},
+		{"empty key", "[PHP]\n= On\n"},
+		{"unclosed array key", "[PHP]\nextension[ = gd\n"},
+		{"unclosed header", "[PHP\n"},
+		{"unterminated quote", "[PHP]\nmotd = \"hello\n"},
+	}
+
+	prefix := statement{{text: "ini", typ: typBare}}
+	for _, tt := range tests {
+		if _, err := statementsFromPHP(strings.NewReader(tt.input), prefix, 0); err == nil {
+			t.Errorf("%s: expected error, got nil", tt.desc)
+		}
+	}
+}
+
+func TestParsePHPValue(t *testing.T) {
+	tests := []struct {
+		text                  string
+		value, quote, comment string
+	}{
+		{`On`, "On", "", ""},
+		{`E_ALL & ~E_NOTICE ; note`, "E_ALL & ~E_NOTICE", "", "; note"},
+		{`"a;b" ; note`, "a;b", `"`, "; note"},
+		{`'C:\dir\'`, `C:\dir\`, "'", ""},
+		{`"a\\b\"c\n"`, `a\b"c\n`, `"`, ""},
+		{`"${HOME}"/bin`, `"${HOME}"/bin`, "", ""},
+		{``, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		value, quote, comment, closed := parsePHPValue(tt.text)
+		if !closed || value != tt.value || quote != tt.quote || comment != tt.comment {
+			t.Errorf("parsePHPValue(%q) = (%q, %q, %q, %v), want (%q, %q, %q, true)",
+				tt.text, value, quote, comment, closed, tt.value, tt.quote, tt.comment)
+		}
+	}
+
+	if _, _, _, closed := parsePHPValue(`"open ; string`); closed {
+		t.Error("parsePHPValue of an unclosed string reported it closed")
+	}
+}
+
+func TestFormatPHPValue(t *testing.T) {
+	tests := []struct {
+		value, quote string
+		want         string
+	}{
+		{"On", "", "On"},
+		{"E_ALL & ~E_NOTICE", "", "E_ALL & ~E_NOTICE"},
+		{"", "", ""},
+		{"", `"`, `""`},
+		{"a;b", "", `"a;b"`},
+		{" padded ", "", `" padded "`},
+		{"it's", "'", `"it's"`},
+		{`C:\dir\`, "'", `'C:\dir\'`},
+		{`a\b"c\`, `"`, `"a\b\"c\\"`},
+	}
+
+	for _, tt := range tests {
+		if got := formatPHPValue(tt.value, tt.quote); got != tt.want {
+			t.Errorf("formatPHPValue(%q, %q) = %q, want %q", tt.value, tt.quote, got, tt.want)
+		}
+		if tt.quote == `"` {
+			if back := unescapePHP(escapePHP(tt.value)); back != tt.value {
+				t.Errorf("unescapePHP(escapePHP(%q)) = %q", tt.value, back)
+			}
+		}
+	}
+}
+
+func TestPHPFromStatements(t *testing.T) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromPHP(strings.NewReader(phpINI), prefix, optComments)
+	if err != nil {
+		t.Fatalf("statementsFromPHP error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := phpFromStatements(ss, &buf); err != nil {
+		t.Fatalf("phpFromStatements error: %v", err)
+	}
+
+	want := `; PHP settings
+[PHP]
+engine = On
+error_reporting = E_ALL & ~E_DEPRECATED ; everything
+include_path = ".:/usr/share/php"
+extension[] = gd
+extension[] = "intl"
+sendmail_path = '/usr/sbin/sendmail -t -i'
+user_dir = ${HOME}/public_html
+memory_limit = 128M
+memory_limit = 256M
+motd = "Welcome,
+say \"hi\" \$x"
+opcache[jit] = tracing
+opcache["buffer size"] = 64
+
+[Date]
+date.timezone = "Europe/Berlin"
+
+[mail function]
+SMTP = localhost
+`
+	if buf.String() != want {
+		t.Errorf("php.ini output:\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestPHPRepeatedKeys(t *testing.T) {
+	input := "[PHP]\nextension = gd\nextension = curl\nextension[] = intl\n"
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromPHP(strings.NewReader(input), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromPHP error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.PHP = {};`,
+		`ini.PHP.extension[0] = "gd";`,
+		`ini.PHP.extension[1] = "curl";`,
+		`ini.PHP.extension[2] = "intl";`,
+		`ini.PHP.extension[2]@array = "append";`,
+	}
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+
+	// One list, so JSON has no conflict to report
+	var buf bytes.Buffer
+	if err := jsonFromStatements(ss, &buf); err != nil {
+		t.Errorf("jsonFromStatements error: %v", err)
+	}
+
+	buf.Reset()
+	if err := phpFromStatements(ss, &buf); err != nil {
+		t.Fatalf("phpFromStatements error: %v", err)
+	}
+	if buf.String() != input {
+		t.Errorf("php.ini output = %q, want %q", buf.String(), input)
+	}
+}
+
+func TestPHPGlobalArrays(t *testing.T) {
+	input := "extension[] = gd\nopcache[mode] = fast\nopcache[\"a b\"] = 1\n\n[PHP]\nengine = On\n"
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromPHP(strings.NewReader(input), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromPHP error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := phpFromStatements(ss, &buf); err != nil {
+		t.Fatalf("phpFromStatements error: %v", err)
+	}
+	if buf.String() != input {
+		t.Errorf("php.ini output = %q, want %q", buf.String(), input)
+	}
+
+	// Without the attribute, three components make an element
+	ss, err = ungrinStatements(strings.NewReader("ini.a.b = \"1\";\nini.s.k.o = \"2\";\n"))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+	buf.Reset()
+	if err := phpFromStatements(ss, &buf); err != nil {
+		t.Fatalf("phpFromStatements error: %v", err)
+	}
+	if want := "[a]\nb = 1\n\n[s]\nk[o] = 2\n"; buf.String() != want {
+		t.Errorf("php.ini output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPHPFromStatementsNested(t *testing.T) {
+	input := `ini.global = "1";
+ini.a.b.c.d = "x";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+	if err := phpFromStatements(ss, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for a key nested too deeply, got nil")
+	}
+}
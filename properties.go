@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// propertiesSpace is the whitespace that separates the parts of a line in
+// a .properties file.
+const propertiesSpace = " \t\f"
+
+// propertiesEscapes maps the characters that may follow a backslash in a
+// .properties file to the characters they stand for. A backslash before
+// any other character stands for that character.
+var propertiesEscapes = map[byte]byte{
+	't': '\t',
+	'n': '\n',
+	'r': '\r',
+	'f': '\f',
+}
+
+// statementsFromProperties reads a Java .properties file from r and
+// produces grin statements rooted at prefix. A dotted key made up of
+// valid identifiers, such as spring.datasource.url, is the key url of the
+// nested section spring.datasource, as a dotted INI section would be; any
+// other key is kept whole. Lines ending in a backslash continue on the
+// next, escapes such as \t and \u00e9 are decoded, and a key assigned
+// again replaces its earlier value, as in java.util.Properties.
+func statementsFromProperties(r io.Reader, prefix statement, opts int) (statements, error) {
+	scanner := bufio.NewScanner(r)
+
+	var (
+		pendingComment []string
+		logical        string
+		start          int
+		continuing     bool
+		data           = iniData{
+			sectionKeys:     make(map[string][]iniKVPair),
+			sectionComments: make(map[string]string),
+			sectionLines:    make(map[string]int),
+		}
+	)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if lineNum == 1 {
+			line = stripBOM(line)
+		}
+		line = strings.TrimLeft(line, propertiesSpace)
+
+		switch {
+		case continuing:
+			logical += line
+		case line == "":
+			continue
+		case line[0] == '#' || line[0] == '!':
+			pendingComment = append(pendingComment, line)
+			continue
+		default:
+			logical, start = line, lineNum
+		}
+
+		if continuing = endsWithContinuation(logical); continuing {
+			logical = logical[:len(logical)-1]
+			continue
+		}
+		if err := addProperty(&data, logical, strings.Join(pendingComment, "\n"), start); err != nil {
+			return nil, err
+		}
+		pendingComment = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+	if continuing {
+		// As in Java, a backslash at the end of the input is dropped
+		if err := addProperty(&data, logical, strings.Join(pendingComment, "\n"), start); err != nil {
+			return nil, err
+		}
+		pendingComment = nil
+	}
+	data.trailingComment = strings.Join(pendingComment, "\n")
+
+	return buildINIStatements(prefix, &data, opts), nil
+}
+
+// endsWithContinuation reports whether line ends with an odd number of
+// backslashes, the last of which continues it on the next line.
+func endsWithContinuation(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, `\`))
+	return n%2 == 1
+}
+
+// addProperty parses the logical line that starts on line lineNum and
+// records its key in d, in the section its dotted name describes.
+func addProperty(d *iniData, logical, comment string, lineNum int) error {
+	rawKey, rawValue := splitProperty(logical)
+	key, err := unescapeProperty(rawKey, lineNum)
+	if err != nil {
+		return err
+	}
+	value, err := unescapeProperty(rawValue, lineNum)
+	if err != nil {
+		return err
+	}
+
+	section, name := propertySection(key)
+	if section != "" {
+		d.addSection(section, "", lineNum)
+	}
+	d.setKey(section, iniKVPair{key: name, value: value, comment: comment, line: lineNum, delimiter: "="})
+	return nil
+}
+
+// splitProperty splits a logical line into its key and value, both still
+// escaped. The key ends at the first unescaped '=', ':' or whitespace,
+// and the value starts after it and any whitespace around it.
+func splitProperty(line string) (key, value string) {
+	end := 0
+	for end < len(line) && !strings.ContainsRune("=:"+propertiesSpace, rune(line[end])) {
+		if line[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	end = min(end, len(line))
+
+	rest := strings.TrimLeft(line[end:], propertiesSpace)
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], propertiesSpace)
+	}
+	return line[:end], rest
+}
+
+// unescapeProperty decodes the escapes in a key or value of the logical
+// line that starts on line lineNum.
+func unescapeProperty(s string, lineNum int) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var units []uint16
+	var b strings.Builder
+	flush := func() {
+		b.WriteString(string(utf16.Decode(units)))
+		units = nil
+	}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] != '\\' || i == len(s)-1:
+			flush()
+			b.WriteByte(s[i])
+		case s[i+1] == 'u':
+			if i+6 > len(s) {
+				return "", fmt.Errorf("line %d: malformed \\uxxxx escape", lineNum)
+			}
+			n, err := strconv.ParseUint(s[i+2:i+6], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("line %d: malformed \\uxxxx escape %q", lineNum, s[i:i+6])
+			}
+			// Surrogate pairs are decoded together
+			units = append(units, uint16(n))
+			i += 5
+		default:
+			flush()
+			i++
+			if c, ok := propertiesEscapes[s[i]]; ok {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte(s[i])
+			}
+		}
+	}
+	flush()
+	return b.String(), nil
+}
+
+// propertySection splits a dotted key made up of valid identifiers into
+// its section and the name of the key within it. Any other key has no
+// section.
+func propertySection(key string) (section, name string) {
+	dot := strings.LastIndexByte(key, '.')
+	if dot == -1 {
+		return "", key
+	}
+	for _, p := range strings.Split(key, ".") {
+		if !validIdentifier(p) {
+			return "", key
+		}
+	}
+	return key[:dot], key[dot+1:]
+}
+
+// propertiesFromStatements writes statements as a Java .properties file:
+// each key is written key=value, with its section's dotted name before it,
+// and keys and values are escaped as java.util.Properties.store escapes
+// them. A repeated key is written with its index, as in key[0].
+func propertiesFromStatements(ss statements, w io.Writer) error {
+	globalKeys, sections, sectionOrder, _ := indexStatements(ss)
+	comments, sectionComments := indexComments(ss)
+
+	for _, kv := range globalKeys {
+		if err := writeProperty(w, "", kv, comments); err != nil {
+			return err
+		}
+	}
+	for _, secName := range sectionOrder {
+		if err := writeHashComment(w, "#!", sectionComments[secName]); err != nil {
+			return err
+		}
+		for _, kv := range sections[secName] {
+			if err := writeProperty(w, secName, kv, comments); err != nil {
+				return err
+			}
+		}
+	}
+	return writeHashComment(w, "#!", sectionComments[""])
+}
+
+// writeProperty writes the line for kv in section, preceded by its comment.
+func writeProperty(w io.Writer, section string, kv ungrinKVPair, comments map[string]string) error {
+	if err := writeHashComment(w, "#!", comments[kv.commentKey()]); err != nil {
+		return err
+	}
+	key := kv.key
+	if section != "" {
+		key = section + "." + key
+	}
+	key = escapeProperty(key, true)
+	if kv.index >= 0 {
+		key += "[" + strconv.Itoa(kv.index) + "]"
+	}
+	_, err := fmt.Fprintf(w, "%s=%s\n", key, escapeProperty(kv.value, false))
+	return err
+}
+
+// propertiesControlEscapes maps the control characters that have escapes
+// of their own to them.
+var propertiesControlEscapes = map[rune]string{
+	'\t': `\t`,
+	'\n': `\n`,
+	'\r': `\r`,
+	'\f': `\f`,
+}
+
+// escapeProperty escapes a key or value for a .properties file, as
+// java.util.Properties.store does, but leaving the '=', ':', '#' and '!'
+// of a value as they are, since only those in a key are special. Spaces
+// are escaped throughout a key but only at the start of a value, and
+// characters outside printable ASCII are written as \uxxxx escapes.
+func escapeProperty(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		esc, ok := propertiesControlEscapes[r]
+		switch {
+		case ok:
+			b.WriteString(esc)
+		case r == '\\' || (key || i == 0) && r == ' ' || key && strings.ContainsRune("=:#!", r):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04X`, u)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestStatementsFromProperties(t *testing.T) {
+	input := `# Application settings
+! generated
+app.name = My App
+app.version: 1.2
+spring.datasource.url=jdbc:postgresql://db:5432/app
+spring.datasource.username   admin
+greeting = Hello, \
+           World
+unicode=caf\u00e9 \ud83d\ude00
+key\ with\ spaces = v
+tabs=a\tb\q
+empty
+server.1.host = x
+app.name = Renamed
+trailing = end\\
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromProperties(strings.NewReader(input), prefix, optComments)
+	if err != nil {
+		t.Fatalf("statementsFromProperties error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.greeting = "Hello, World";`,
+		`ini.unicode = "café 😀";`,
+		`ini["key with spaces"] = "v";`,
+		`ini.tabs = "a\tbq";`,
+		`ini.empty = "";`,
+		`ini["server.1.host"] = "x";`,
+		`ini.trailing = "end\\";`,
+		`ini.app = {};`,
+		`ini.app.version = "1.2";`,
+		`ini.app.name # "# Application settings\n! generated";`,
+		`ini.app.name = "Renamed";`,
+		`ini.spring = {};`,
+		`ini.spring.datasource = {};`,
+		`ini.spring.datasource.url = "jdbc:postgresql://db:5432/app";`,
+		`ini.spring.datasource.username = "admin";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestStatementsFromPropertiesContinuedPastTheEnd(t *testing.T) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromProperties(strings.NewReader("key = a \\"), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromProperties error: %v", err)
+	}
+	if got := statementToString(ss[len(ss)-1]); got != `ini.key = "a ";` {
+		t.Errorf("got %q, want the value without its backslash", got)
+	}
+}
+
+func TestStatementsFromPropertiesErrors(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{"short unicode escape", "key = \\u00e\n"},
+		{"invalid unicode escape", "key = \\u00zz\n"},
+		{"invalid escape in key", "k\\uqqqq = v\n"},
+	}
+
+	prefix := statement{{text: "ini", typ: typBare}}
+	for _, tt := range tests {
+		if _, err := statementsFromProperties(strings.NewReader(tt.input), prefix, 0); err == nil {
+			t.Errorf("%s: expected error, got nil", tt.desc)
+		}
+	}
+}
+
+func TestSplitProperty(t *testing.T) {
+	tests := []struct {
+		line       string
+		key, value string
+	}{
+		{"a=b", "a", "b"},
+		{"a = b", "a", "b"},
+		{"a:b", "a", "b"},
+		{"a b", "a", "b"},
+		{"a  =  b = c", "a", "b = c"},
+		{`a\=b=c`, `a\=b`, "c"},
+		{`a\ b c`, `a\ b`, "c"},
+		{"a", "a", ""},
+		{`a\`, `a\`, ""},
+	}
+
+	for _, tt := range tests {
+		key, value := splitProperty(tt.line)
+		if key != tt.key || value != tt.value {
+			t.Errorf("splitProperty(%q) = (%q, %q), want (%q, %q)", tt.line, key, value, tt.key, tt.value)
+		}
+	}
+}
+
+func TestPropertiesFromStatements(t *testing.T) {
+	input := `ini = {};
+ini # "; settings";
+ini.name = "My App";
+ini["key with spaces"] = " leading";
+ini.unicode = "café 😀";
+ini.url = "jdbc:postgresql://db/app#x";
+ini.spring.datasource = {};
+ini.spring.datasource.password = "a\\b\nc";
+ini.list.item[1] = "b";
+ini.list.item[0] = "a";
+ini.empty = {};
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := propertiesFromStatements(ss, &buf); err != nil {
+		t.Fatalf("propertiesFromStatements error: %v", err)
+	}
+
+	want := `name=My App
+key\ with\ spaces=\ leading
+unicode=caf\u00E9 \uD83D\uDE00
+url=jdbc:postgresql://db/app#x
+spring.datasource.password=a\\b\nc
+list.item[0]=a
+list.item[1]=b
+# settings
+`
+	if buf.String() != want {
+		t.Errorf("properties output:\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// And back again
+	prefix := statement{{text: "ini", typ: typBare}}
+	again, err := statementsFromProperties(strings.NewReader(buf.String()), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromProperties error: %v", err)
+	}
+	values := assignmentValues(again)
+	for _, path := range []string{`ini.name`, `ini["key with spaces"]`, `ini.unicode`, `ini.url`, `ini.spring.datasource.password`} {
+		if values[path].text != assignmentValues(ss)[path].text {
+			t.Errorf("round trip %s = %s, want %s", path, values[path].text, assignmentValues(ss)[path].text)
+		}
+	}
+}
+
+func TestEscapeProperty(t *testing.T) {
+	tests := []struct {
+		s    string
+		key  bool
+		want string
+	}{
+		{"a b", true, `a\ b`},
+		{"a b", false, `a b`},
+		{" a", false, `\ a`},
+		{"a=b:c#!", true, `a\=b\:c\#\!`},
+		{"a=b:c#!", false, `a=b:c#!`},
+		{"\t\n\r\f", false, `\t\n\r\f`},
+		{"\x01", false, `\u0001`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeProperty(tt.s, tt.key); got != tt.want {
+			t.Errorf("escapeProperty(%q, %v) = %q, want %q", tt.s, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestPropertiesKeyAndSectionComments(t *testing.T) {
+	input := "# c\nlogging.level=INFO\nlogging.level.root=WARN\n"
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromProperties(strings.NewReader(input), prefix, optComments)
+	if err != nil {
+		t.Fatalf("statementsFromProperties error: %v", err)
+	}
+	sort.Sort(ss)
+
+	var buf bytes.Buffer
+	if err := propertiesFromStatements(ss, &buf); err != nil {
+		t.Fatalf("propertiesFromStatements error: %v", err)
+	}
+	if buf.String() != input {
+		t.Errorf("properties output = %q, want %q", buf.String(), input)
+	}
+
+	buf.Reset()
+	if err := ungrinFromStatements(ss, &buf); err != nil {
+		t.Fatalf("ungrinFromStatements error: %v", err)
+	}
+	want := "[logging]\n# c\nlevel = INFO\n\n[logging.level]\nroot = WARN\n"
+	if buf.String() != want {
+		t.Errorf("ungrin output = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// setTarget is the key addressed by a grin path on the command line.
+type setTarget struct {
+	section string
+	key     string
+	index   int
+}
+
+// parseSetTarget resolves a grin path such as `ini.database.port` or
+// `ini.php.extension[1]` into the section and key it names.
+func parseSetTarget(path string) (setTarget, error) {
+	s, err := lexPath(path)
+	if err != nil {
+		return setTarget{}, err
+	}
+	t, ok := targetFromStatement(s)
+	if !ok {
+		return setTarget{}, fmt.Errorf("path %q does not name a key", path)
+	}
+	return t, nil
+}
+
+// targetFromStatement returns the section and key addressed by the path of
+// s. ok is false if the path names the root rather than a key.
+func targetFromStatement(s statement) (t setTarget, ok bool) {
+	parts, _, _ := extractPathAndValue(s)
+	if len(parts) == 0 {
+		return setTarget{}, false
+	}
+	return setTarget{
+		section: strings.Join(parts[:len(parts)-1], "."),
+		key:     parts[len(parts)-1],
+		index:   statementIndex(s),
+	}, true
+}
+
+// setCommand implements `grin set FILE PATH VALUE`: it changes (or adds)
+// a single value, rewriting only the affected line of FILE. A FILE of "-"
+// reads stdin and writes the result to w.
+func setCommand(args []string, stdin io.Reader, w io.Writer, _ readerFn, opts int) (int, error) {
+	if len(args) != 3 {
+		return exitInvalidOptions, errors.New("usage: grin set FILE PATH VALUE")
+	}
+	filename, path, value := args[0], args[1], args[2]
+
+	target, err := parseSetTarget(path)
+	if err != nil {
+		return exitParseStatements, err
+	}
+
+	var src []byte
+	if filename == "-" {
+		src, err = io.ReadAll(stdin)
+		if err != nil {
+			return exitReadInput, err
+		}
+	} else {
+		src, err = os.ReadFile(filename)
+		if err != nil {
+			return exitOpenFile, err
+		}
+	}
+
+	doc, err := parseINIDocument(string(src), opts)
+	if err != nil {
+		return exitFormStatements, err
+	}
+	if err := doc.set(target.section, target.key, target.index, value); err != nil {
+		return exitFormStatements, err
+	}
+
+	if filename == "-" {
+		if _, err := io.WriteString(w, doc.String()); err != nil {
+			return exitWriteFile, err
+		}
+		return exitOK, nil
+	}
+	if err := replaceFile(filename, doc.String()); err != nil {
+		return exitWriteFile, err
+	}
+	return exitOK, nil
+}
+
+// replaceFile atomically replaces the contents of filename, keeping its
+// permissions, by writing a temporary file alongside it and renaming.
+func replaceFile(filename, contents string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".grin-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // no-op once renamed
+
+	if _, err := io.WriteString(tmp, contents); err != nil {
+		tmp.Close() //nolint:errcheck // already failing
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
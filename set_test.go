@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSetTarget(t *testing.T) {
+	tests := []struct {
+		path string
+		want setTarget
+	}{
+		{"ini.key", setTarget{section: "", key: "key", index: -1}},
+		{"ini.database.port", setTarget{section: "database", key: "port", index: -1}},
+		{"ini.database.pool.max", setTarget{section: "database.pool", key: "max", index: -1}},
+		{"ini.php.extension[2]", setTarget{section: "php", key: "extension", index: 2}},
+		{`ini["http://example.com"]["my key"]`, setTarget{section: "http://example.com", key: "my key", index: -1}},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSetTarget(tt.path)
+		if err != nil {
+			t.Errorf("parseSetTarget(%q) error: %v", tt.path, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSetTarget(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseSetTargetErrors(t *testing.T) {
+	for _, path := range []string{"", "ini", "ini.", "ini.key = \"v\";", "ini[x]"} {
+		if _, err := parseSetTarget(path); err == nil {
+			t.Errorf("parseSetTarget(%q): expected error, got nil", path)
+		}
+	}
+}
+
+func TestSetCommandFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.ini")
+	input := "; Database\n[database]\nhost = localhost\nport = 5432\n"
+	if err := os.WriteFile(filename, []byte(input), 0o640); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	exitCode, err := setCommand([]string{filename, "ini.database.port", "5433"}, nil, &buf, nil, 0)
+	if err != nil {
+		t.Fatalf("setCommand error: %v", err)
+	}
+	if exitCode != exitOK {
+		t.Fatalf("setCommand exit code: %d", exitCode)
+	}
+
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	want := "; Database\n[database]\nhost = localhost\nport = 5433\n"
+	if string(got) != want {
+		t.Errorf("file after set = %q, want %q", got, want)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Stat error: %v", err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("file mode = %v, want %v", info.Mode().Perm(), os.FileMode(0o640))
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
+func TestSetCommandStdin(t *testing.T) {
+	input := "[database]\nhost = localhost\n"
+
+	var buf bytes.Buffer
+	exitCode, err := setCommand([]string{"-", "ini.database.port", "5432"}, strings.NewReader(input), &buf, nil, 0)
+	if err != nil {
+		t.Fatalf("setCommand error: %v", err)
+	}
+	if exitCode != exitOK {
+		t.Fatalf("setCommand exit code: %d", exitCode)
+	}
+
+	want := "[database]\nhost = localhost\nport = 5432\n"
+	if buf.String() != want {
+		t.Errorf("setCommand output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestSetCommandErrors(t *testing.T) {
+	tests := []struct {
+		args  []string
+		input string
+		want  int
+	}{
+		{[]string{"-", "ini.key"}, "", exitInvalidOptions},
+		{[]string{"-", "ini", "v"}, "", exitParseStatements},
+		{[]string{filepath.Join(t.TempDir(), "missing.ini"), "ini.key", "v"}, "", exitOpenFile},
+		{[]string{"-", "ini.key", "v"}, "[broken\n", exitFormStatements},
+		{[]string{"-", "ini.s.k", "v"}, "[s]\nk = 1\nk = 2\n", exitFormStatements},
+		{[]string{"-", `ini.s["a=b"]`, "v"}, "[s]\nk = 1\n", exitFormStatements},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		exitCode, err := setCommand(tt.args, strings.NewReader(tt.input), &buf, nil, 0)
+		if err == nil {
+			t.Errorf("setCommand(%q): expected error, got nil", tt.args)
+		}
+		if exitCode != tt.want {
+			t.Errorf("setCommand(%q): exit code = %d, want %d", tt.args, exitCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// shellFolds maps the --shell-case names to the case folding they apply
+// to variable names.
+var shellFolds = map[string]func(rune) rune{
+	"upper": unicode.ToUpper,
+	"lower": unicode.ToLower,
+	"keep":  func(r rune) rune { return r },
+}
+
+// shellStyle sets how shell output names its variables.
+type shellStyle struct {
+	// separator joins the section names and key of a variable.
+	separator string
+	// fold is the case folding applied to names.
+	fold func(rune) rune
+	// prefix starts each name.
+	prefix string
+}
+
+// defaultShellStyle names variables as in DATABASE_HOST.
+var defaultShellStyle = shellStyle{separator: "_", fold: unicode.ToUpper}
+
+// newShellStyle returns the style for the --shell-separator, --shell-case
+// and --shell-prefix options. The separator and prefix must be made of
+// characters that can appear in a variable name, and the prefix can't
+// start with a digit.
+func newShellStyle(separator, foldName, prefix string) (shellStyle, error) {
+	fold, ok := shellFolds[foldName]
+	if !ok {
+		return shellStyle{}, fmt.Errorf("unknown case %q (want one of %s)", foldName, formatNames(shellFolds))
+	}
+	if !isShellName(separator) {
+		return shellStyle{}, fmt.Errorf("separator %q can't appear in a variable name", separator)
+	}
+	if !isShellName(prefix) || prefix != "" && prefix[0] >= '0' && prefix[0] <= '9' {
+		return shellStyle{}, fmt.Errorf("prefix %q can't start a variable name", prefix)
+	}
+	return shellStyle{separator: separator, fold: fold, prefix: prefix}, nil
+}
+
+// isShellName reports whether s is made only of the ASCII letters, digits
+// and underscores that can appear in a shell variable name.
+func isShellName(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// name returns the variable name for kv in the dotted section.
+func (st shellStyle) name(section string, kv ungrinKVPair) string {
+	return variableName(st.prefix, section, kv, st.separator, st.fold)
+}
+
+// shellWriter returns a writer that renders statements as POSIX shell
+// export commands, one per key, named in style, such as
+// export DATABASE_HOST='db.example.com'. The output can be evaluated by
+// a shell script to set each variable. Comments, inline ones included,
+// are written on lines of their own so that nothing but the quoted value
+// follows an export.
+func shellWriter(style shellStyle) writerFn {
+	return func(ss statements, w io.Writer, opts int) error {
+		return writeVariables(ss, w, style.name, func(name, value string) string {
+			return "export " + name + "=" + quoteShell(value)
+		}, false)
+	}
+}
+
+// quoteShell quotes value for a POSIX shell. Everything between single
+// quotes is taken as it is, newlines included, so a single quote in value
+// ends the quotes, is escaped, and starts them again.
+func quoteShell(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
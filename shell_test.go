@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestShellWriter(t *testing.T) {
+	input := `ini = {};
+ini.app_name = "SuperApp";
+ini.database # "; connection";
+ini.database = {};
+ini.database.host = "db.example.com";
+ini.database.password = "it's $secret";
+ini.database["max-conns"] = "20";
+ini.database.pool = {};
+ini.database.pool.min = "5";
+ini.servers.host[1] = "b";
+ini.servers.host[0] = "a";
+ini.motd = "hello\nworld";
+ini.motd@comment = "# shown at login";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := shellWriter(defaultShellStyle)(ss, &buf, 0); err != nil {
+		t.Fatalf("shellWriter error: %v", err)
+	}
+
+	want := `export APP_NAME='SuperApp'
+# shown at login
+export MOTD='hello
+world'
+# connection
+export DATABASE_HOST='db.example.com'
+export DATABASE_PASSWORD='it'\''s $secret'
+export DATABASE_MAX_CONNS='20'
+export DATABASE_POOL_MIN='5'
+export SERVERS_HOST_0='a'
+export SERVERS_HOST_1='b'
+`
+	if buf.String() != want {
+		t.Errorf("shell output:\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return
+	}
+	out, err := exec.Command(sh, "-c", buf.String()+`printf '%s|%s' "$DATABASE_PASSWORD" "$MOTD"`).Output()
+	if err != nil {
+		t.Fatalf("sh error: %v", err)
+	}
+	if got := string(out); got != "it's $secret|hello\nworld" {
+		t.Errorf("sh read back %q", got)
+	}
+}
+
+func TestShellWriterInlineComments(t *testing.T) {
+	input := "[db]\nhost = h ; touch grin-pwned\nport = 1 # x\n"
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, optComments|optInlineComments)
+	if err != nil {
+		t.Fatalf("statementsFromINI error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := shellWriter(defaultShellStyle)(ss, &buf, 0); err != nil {
+		t.Fatalf("shellWriter error: %v", err)
+	}
+	want := `# touch grin-pwned
+export DB_HOST='h'
+# x
+export DB_PORT='1'
+`
+	if buf.String() != want {
+		t.Errorf("shell output:\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return
+	}
+	dir := t.TempDir()
+	cmd := exec.Command(sh, "-c", buf.String()+`printf '%s' "$DB_HOST"; ls`)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("sh error: %v", err)
+	}
+	if got := string(out); got != "h" {
+		t.Errorf("sh output %q, want only the value", got)
+	}
+}
+
+func TestShellWriterCollision(t *testing.T) {
+	input := `ini.a.b = "1";
+ini.a_b = "2";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+	if err := shellWriter(defaultShellStyle)(ss, &bytes.Buffer{}, 0); err == nil {
+		t.Error("expected error for keys with the same variable name, got nil")
+	}
+
+	// A different separator keeps them apart
+	style, err := newShellStyle("__", "upper", "")
+	if err != nil {
+		t.Fatalf("newShellStyle error: %v", err)
+	}
+	if err := shellWriter(style)(ss, &bytes.Buffer{}, 0); err != nil {
+		t.Errorf("shellWriter with __ separator error: %v", err)
+	}
+}
+
+func TestShellStyleName(t *testing.T) {
+	tests := []struct {
+		separator, fold, prefix string
+		section                 string
+		kv                      ungrinKVPair
+		want                    string
+	}{
+		{"_", "upper", "", "database.pool", ungrinKVPair{key: "max", index: -1}, "DATABASE_POOL_MAX"},
+		{"_", "lower", "", "Database", ungrinKVPair{key: "Host", index: -1}, "database_host"},
+		{"_", "keep", "", "Database", ungrinKVPair{key: "Host", index: -1}, "Database_Host"},
+		{"__", "upper", "", "a", ungrinKVPair{key: "b", index: 1}, "A__B__1"},
+		{"", "upper", "", "a", ungrinKVPair{key: "b", index: -1}, "AB"},
+		{"_", "upper", "App_", "", ungrinKVPair{key: "port", index: -1}, "App_PORT"},
+		{"_", "upper", "", "", ungrinKVPair{key: "1st", index: -1}, "_1ST"},
+		{"_", "upper", "", "", ungrinKVPair{key: "max-conns", index: -1}, "MAX_CONNS"},
+	}
+
+	for _, tt := range tests {
+		style, err := newShellStyle(tt.separator, tt.fold, tt.prefix)
+		if err != nil {
+			t.Fatalf("newShellStyle(%q, %q, %q) error: %v", tt.separator, tt.fold, tt.prefix, err)
+		}
+		if got := style.name(tt.section, tt.kv); got != tt.want {
+			t.Errorf("name(%q, %+v) with %q, %q, %q = %q, want %q",
+				tt.section, tt.kv, tt.separator, tt.fold, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestNewShellStyleErrors(t *testing.T) {
+	tests := []struct {
+		desc                    string
+		separator, fold, prefix string
+	}{
+		{"unknown case", "_", "title", ""},
+		{"dash in separator", "-", "upper", ""},
+		{"dot in prefix", "_", "upper", "app."},
+		{"prefix starting with a digit", "_", "upper", "1_"},
+	}
+
+	for _, tt := range tests {
+		if _, err := newShellStyle(tt.separator, tt.fold, tt.prefix); err == nil {
+			t.Errorf("%s: expected error, got nil", tt.desc)
+		}
+	}
+}
+
+func TestQuoteShell(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"", "''"},
+		{"plain", "'plain'"},
+		{"$HOME `cmd` \"x\"", "'$HOME `cmd` \"x\"'"},
+		{"it's", `'it'\''s'`},
+		{"a\nb", "'a\nb'"},
+	}
+
+	for _, tt := range tests {
+		if got := quoteShell(tt.value); got != tt.want {
+			t.Errorf("quoteShell(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSelectShellFormats(t *testing.T) {
+	ss, err := ungrinStatements(strings.NewReader(`ini.db.host = "x";`))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	_, write, _, err := selectShellFormats("ini", "shell", "_", "lower", "app_")
+	if err != nil {
+		t.Fatalf("selectShellFormats error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := write(ss, &buf, 0); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	if got, want := buf.String(), "export app_db_host='x'\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, _, _, err := selectShellFormats("ini", "shell", "_", "title", ""); err == nil {
+		t.Error("expected error for an unknown case, got nil")
+	}
+	// The --shell-* options only matter for shell output
+	if _, _, _, err := selectShellFormats("ini", "json", "_", "title", ""); err != nil {
+		t.Errorf("selectShellFormats for json error: %v", err)
+	}
+}
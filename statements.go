@@ -1,6 +1,9 @@
 package main
 
-import "strings"
+import (
+	"strconv"
+	"strings"
+)
 
 // statement is an ordered list of tokens representing one grin assignment line.
 // e.g. ini.section.key = "value";
@@ -29,6 +32,14 @@ func (ss statements) Less(i, j int) bool {
 		at := a[k]
 		bt := b[k]
 
+		// Comments come before the assignment they describe
+		if at.typ == typHash && bt.typ != typHash {
+			return true
+		}
+		if bt.typ == typHash && at.typ != typHash {
+			return false
+		}
+
 		// Equals always comes first (so "ini = {}" sorts before "ini.x = ...")
 		if at.typ == typEquals && bt.typ != typEquals {
 			return true
@@ -37,6 +48,16 @@ func (ss statements) Less(i, j int) bool {
 			return false
 		}
 
+		// Indexes of repeated keys sort numerically
+		if at.typ == typNumericKey && bt.typ == typNumericKey {
+			an, _ := strconv.Atoi(at.text)
+			bn, _ := strconv.Atoi(bt.text)
+			if an != bn {
+				return an < bn
+			}
+			continue
+		}
+
 		if at.text != bt.text {
 			return at.text < bt.text
 		}
@@ -55,17 +76,69 @@ func (s statement) withBare(key string) statement {
 	)
 }
 
-// withPath appends a dotted path (e.g. "section.subsection") as a series
-// of dot-separated bare tokens.
-func (s statement) withPath(dotted string) statement {
-	parts := strings.Split(dotted, ".")
+// withIndex appends an index segment like "[0]", used to tell apart the
+// occurrences of a repeated key.
+func (s statement) withIndex(i int) statement {
+	new := make(statement, len(s), len(s)+3)
+	copy(new, s)
+	return append(new,
+		token{"[", typLBrace},
+		token{strconv.Itoa(i), typNumericKey},
+		token{"]", typRBrace},
+	)
+}
+
+// withKey appends one path component: a dot and a bare identifier when key
+// is a valid identifier, or a bracketed quoted key like ["my key"] otherwise.
+func (s statement) withKey(key string) statement {
+	if validIdentifier(key) {
+		return s.withBare(key)
+	}
+	return s.withQuotedKey(key)
+}
+
+// withQuotedKey appends a bracketed quoted key like ["origin"], whether or
+// not key is a valid identifier.
+func (s statement) withQuotedKey(key string) statement {
+	new := make(statement, len(s), len(s)+3)
+	copy(new, s)
+	return append(new,
+		token{"[", typLBrace},
+		token{quoteString(key), typQuotedKey},
+		token{"]", typRBrace},
+	)
+}
+
+// withoutIndex returns path without the index segments of repeated keys,
+// so that ini.php.extension[1] becomes ini.php.extension.
+func withoutIndex(path statement) statement {
+	out := make(statement, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i].typ == typLBrace && i+1 < len(path) && path[i+1].typ == typNumericKey {
+			// Skip the index and its closing bracket
+			i += 2
+			continue
+		}
+		out = append(out, path[i])
+	}
+	return out
+}
+
+// withKeys appends each of parts as a path component.
+func (s statement) withKeys(parts []string) statement {
 	cur := s
 	for _, p := range parts {
-		cur = cur.withBare(p)
+		cur = cur.withKey(p)
 	}
 	return cur
 }
 
+// withPath appends a dotted path (e.g. "section.subsection") as a series
+// of path components.
+func (s statement) withPath(dotted string) statement {
+	return s.withKeys(strings.Split(dotted, "."))
+}
+
 // withValue appends an equals sign, a value token, and a semicolon.
 func (s statement) withValue(t token) statement {
 	new := make(statement, len(s), len(s)+4)
@@ -87,6 +160,44 @@ func (s statement) withStringValue(val string) statement {
 	return s.withValue(token{quoteString(val), typString})
 }
 
+// withComment appends " # \"comment\";" to the statement, attaching a
+// (possibly multi-line) comment to the path it follows.
+func (s statement) withComment(text string) statement {
+	new := make(statement, len(s), len(s)+3)
+	copy(new, s)
+	return append(new,
+		token{" # ", typHash},
+		token{quoteString(text), typComment},
+		token{";", typSemi},
+	)
+}
+
+// withAttribute appends "@name" to the statement, addressing an attribute
+// of the key it names, such as how a multi-line value is continued. The
+// result takes a value like any other path.
+func (s statement) withAttribute(name string) statement {
+	return append(s[:len(s):len(s)], token{"@", typAt}, token{name, typAttribute})
+}
+
+// withPosition appends a " // 42" source position comment, recording the
+// line of the input that the statement came from.
+func (s statement) withPosition(line int) statement {
+	return append(s[:len(s):len(s)], token{" // " + strconv.Itoa(line), typPosition})
+}
+
+// locatePositions names the file that the source positions in ss refer
+// to, turning " // 42" into " // app.ini:42". Positions that already name
+// a file are left alone.
+func locatePositions(ss statements, filename string) {
+	for _, s := range ss {
+		last := len(s) - 1
+		if last < 0 || s[last].typ != typPosition || strings.Contains(s[last].text, ":") {
+			continue
+		}
+		s[last].text = " // " + filename + ":" + strings.TrimPrefix(s[last].text, " // ")
+	}
+}
+
 // statementToString renders a statement as a plain string.
 func statementToString(s statement) string {
 	var b strings.Builder
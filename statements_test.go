@@ -44,6 +44,7 @@ func TestStatementWithPath(t *testing.T) {
 		{"section", "ini.section"},
 		{"section.sub", "ini.section.sub"},
 		{"a.b.c", "ini.a.b.c"},
+		{"has space.sub", `ini["has space"].sub`},
 	}
 
 	for _, tt := range tests {
@@ -54,6 +55,29 @@ func TestStatementWithPath(t *testing.T) {
 	}
 }
 
+func TestStatementWithKey(t *testing.T) {
+	base := statement{{text: "ini", typ: typBare}}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"section", "ini.section"},
+		{"my-key", "ini.my-key"},
+		{"2fa", `ini["2fa"]`},
+		{"has space", `ini["has space"]`},
+		{"http://example.com", `ini["http://example.com"]`},
+		{`say "hi"`, `ini["say \"hi\""]`},
+	}
+
+	for _, tt := range tests {
+		got := statementToString(base.withKey(tt.key))
+		if got != tt.want {
+			t.Errorf("withKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
 func TestStatementWithEmptyObject(t *testing.T) {
 	base := statement{{text: "ini", typ: typBare}}
 	got := statementToString(base.withEmptyObject())
@@ -125,6 +149,68 @@ func TestStatementsSortSections(t *testing.T) {
 	}
 }
 
+func TestStatementsSortComments(t *testing.T) {
+	ss := statements{
+		makeAssignment("ini", "a.key", "val"),
+		makeSectionObj("ini", "a"),
+		statement{{text: "ini", typ: typBare}}.withPath("a.key").withComment("; key"),
+		statement{{text: "ini", typ: typBare}}.withPath("a").withComment("; section"),
+		makeEmptyObj("ini"),
+	}
+
+	sort.Sort(ss)
+
+	want := []string{
+		`ini = {};`,
+		`ini.a # "; section";`,
+		`ini.a = {};`,
+		`ini.a.key # "; key";`,
+		`ini.a.key = "val";`,
+	}
+
+	for i, w := range want {
+		got := statementToString(ss[i])
+		if got != w {
+			t.Errorf("sorted[%d] = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestStatementWithComment(t *testing.T) {
+	base := statement{{text: "ini", typ: typBare}}.withBare("key")
+	got := statementToString(base.withComment("; line one\n; line two"))
+	want := `ini.key # "; line one\n; line two";`
+	if got != want {
+		t.Errorf("withComment() = %q, want %q", got, want)
+	}
+}
+
+func TestStatementsSortIndexes(t *testing.T) {
+	base := statement{{text: "ini", typ: typBare}}.withBare("ext")
+	ss := statements{
+		base.withIndex(10).withStringValue("k"),
+		base.withIndex(2).withStringValue("c"),
+		base.withIndex(0).withStringValue("a"),
+		base.withIndex(1).withStringValue("b"),
+	}
+
+	sort.Sort(ss)
+
+	want := []string{
+		`ini.ext[0] = "a";`,
+		`ini.ext[1] = "b";`,
+		`ini.ext[2] = "c";`,
+		`ini.ext[10] = "k";`,
+	}
+
+	for i, w := range want {
+		got := statementToString(ss[i])
+		if got != w {
+			t.Errorf("sorted[%d] = %q, want %q", i, got, w)
+		}
+	}
+}
+
 func TestStatementWithBareDoesNotMutateOriginal(t *testing.T) {
 	base := statement{{text: "ini", typ: typBare}}
 	_ = base.withBare("section")
@@ -150,3 +236,56 @@ func makeSectionObj(root, section string) statement {
 	base := statement{{text: root, typ: typBare}}
 	return base.withPath(section).withEmptyObject()
 }
+
+func TestStatementWithPosition(t *testing.T) {
+	base := statement{{text: "ini", typ: typBare}}.withBare("key").withStringValue("v")
+	s := base.withPosition(42)
+	if got := statementToString(s); got != `ini.key = "v"; // 42` {
+		t.Errorf("withPosition = %q", got)
+	}
+	if got := statementToString(base); got != `ini.key = "v";` {
+		t.Errorf("withPosition mutated the original: %q", got)
+	}
+
+	other := statement{{text: "ini", typ: typBare}}.withEmptyObject().withPosition(1)
+	ss := statements{s, other, base}
+	locatePositions(ss, "conf.d/app.ini")
+	locatePositions(ss, "ignored.ini")
+
+	want := []string{
+		`ini.key = "v"; // conf.d/app.ini:42`,
+		`ini = {}; // conf.d/app.ini:1`,
+		`ini.key = "v";`,
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("locatePositions[%d] = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestStatementWithAttribute(t *testing.T) {
+	base := statement{{text: "ini", typ: typBare}}.withBare("key")
+	s := base.withAttribute("continuation").withStringValue("backslash")
+	if got := statementToString(s); got != `ini.key@continuation = "backslash";` {
+		t.Errorf("withAttribute = %q", got)
+	}
+	if got := statementToString(base); got != `ini.key` {
+		t.Errorf("withAttribute mutated the original: %q", got)
+	}
+}
+
+func TestWithoutIndex(t *testing.T) {
+	path := statement{{text: "ini", typ: typBare}}.withBare("Unit").withBare("After").withIndex(3)
+	if got := statementToString(withoutIndex(path)); got != `ini.Unit.After` {
+		t.Errorf("withoutIndex = %q", got)
+	}
+	if got := statementToString(path); got != `ini.Unit.After[3]` {
+		t.Errorf("withoutIndex mutated the original: %q", got)
+	}
+
+	quoted := statement{{text: "ini", typ: typBare}}.withQuotedKey("a b")
+	if got := statementToString(withoutIndex(quoted)); got != `ini["a b"]` {
+		t.Errorf("withoutIndex(quoted) = %q", got)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// systemdListKeys are the settings whose assignments add to a list rather
+// than replace the value before them, as described in systemd.unit(5),
+// systemd.service(5), systemd.exec(5) and their relatives. Settings whose
+// names start with Condition or Assert are lists too.
+var systemdListKeys = map[string]bool{
+	"After": true, "Before": true, "Wants": true, "Requires": true,
+	"Requisite": true, "BindsTo": true, "PartOf": true, "Upholds": true,
+	"Conflicts": true, "OnFailure": true, "OnSuccess": true,
+	"PropagatesReloadTo": true, "ReloadPropagatedFrom": true,
+	"JoinsNamespaceOf": true, "RequiresMountsFor": true, "Documentation": true,
+	"WantedBy": true, "RequiredBy": true, "UpheldBy": true, "Also": true, "Alias": true,
+	"ExecCondition": true, "ExecStartPre": true, "ExecStart": true, "ExecStartPost": true,
+	"ExecReload": true, "ExecStop": true, "ExecStopPost": true,
+	"Environment": true, "EnvironmentFile": true, "PassEnvironment": true, "UnsetEnvironment": true,
+	"ReadWritePaths": true, "ReadOnlyPaths": true, "InaccessiblePaths": true,
+	"ExecPaths": true, "NoExecPaths": true, "BindPaths": true, "BindReadOnlyPaths": true,
+	"TemporaryFileSystem": true, "DeviceAllow": true, "SupplementaryGroups": true,
+	"SystemCallFilter": true, "RestrictAddressFamilies": true,
+	"CapabilityBoundingSet": true, "AmbientCapabilities": true,
+	"IPAddressAllow": true, "IPAddressDeny": true, "LoadCredential": true, "SetCredential": true,
+	"ListenStream": true, "ListenDatagram": true, "ListenSequentialPacket": true,
+	"ListenFIFO": true, "ListenSpecial": true, "ListenNetlink": true,
+	"ListenMessageQueue": true, "ListenUSBFunction": true, "Symlinks": true, "Sockets": true,
+	"OnActiveSec": true, "OnBootSec": true, "OnStartupSec": true,
+	"OnUnitActiveSec": true, "OnUnitInactiveSec": true, "OnCalendar": true,
+}
+
+// isSystemdListKey reports whether the setting key is a list.
+func isSystemdListKey(key string) bool {
+	return systemdListKeys[key] || strings.HasPrefix(key, "Condition") || strings.HasPrefix(key, "Assert")
+}
+
+// statementsFromSystemd reads a systemd unit file from r and produces grin
+// statements rooted at prefix, one section per path component, as in
+// ini.Service.ExecStart. Names are case-sensitive and values are taken as
+// they are, quotes included. A line ending in a backslash continues on the
+// next, joined with a space. Settings assigned more than once are given
+// indexes, and an empty assignment, which resets a list, is kept as one.
+func statementsFromSystemd(r io.Reader, prefix statement, opts int) (statements, error) {
+	scanner := bufio.NewScanner(r)
+
+	var (
+		currentSection string
+		pendingComment []string
+		open           *iniKVPair
+		data           = iniData{
+			sectionKeys:     make(map[string][]iniKVPair),
+			sectionComments: make(map[string]string),
+			sectionLines:    make(map[string]int),
+			sectionPath: func(prefix statement, name string) []statement {
+				return []statement{prefix.withKey(name)}
+			},
+		}
+	)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if lineNum == 1 {
+			line = stripBOM(line)
+		}
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed != "" && (trimmed[0] == ';' || trimmed[0] == '#'):
+			// Comments may come between continued lines
+			if open == nil {
+				pendingComment = append(pendingComment, trimmed)
+			}
+			continue
+		case open != nil:
+			open = continueSystemdValue(&data, currentSection, open, trimmed)
+			continue
+		case trimmed == "":
+			continue
+		}
+		comment := strings.Join(pendingComment, "\n")
+		pendingComment = nil
+
+		if trimmed[0] == '[' {
+			name, err := parseSectionHeader(trimmed, lineNum)
+			if err != nil {
+				return nil, err
+			}
+			currentSection = name
+			data.addSection(name, comment, lineNum)
+			continue
+		}
+		if currentSection == "" {
+			return nil, fmt.Errorf("line %d: assignment outside of a section", lineNum)
+		}
+
+		eqIdx := strings.IndexByte(trimmed, '=')
+		if eqIdx <= 0 {
+			return nil, fmt.Errorf("line %d: expected Key=Value, got %q", lineNum, trimmed)
+		}
+		pair := iniKVPair{key: strings.TrimSpace(trimmed[:eqIdx]), comment: comment, line: lineNum, delimiter: "="}
+		open = continueSystemdValue(&data, currentSection, &pair, strings.TrimSpace(trimmed[eqIdx+1:]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+	if open != nil {
+		data.addKey(currentSection, *open)
+	}
+	data.trailingComment = strings.Join(pendingComment, "\n")
+
+	return buildINIStatements(prefix, &data, opts), nil
+}
+
+// continueSystemdValue adds text to the value of pair. If text ends with a
+// backslash, the value continues on the next line and pair is returned;
+// otherwise the setting is recorded and nil is returned.
+func continueSystemdValue(d *iniData, section string, pair *iniKVPair, text string) *iniKVPair {
+	if pair.value != "" && text != "" {
+		pair.value += " "
+	}
+	if value, more := trimContinuation(text); more {
+		pair.value += value
+		return pair
+	}
+	pair.value += text
+	d.addKey(section, *pair)
+	return nil
+}
+
+// systemdFromStatements writes statements as a systemd unit file, with
+// settings written Key=Value and a blank line between sections. Values
+// that span several lines are continued with backslashes.
+func systemdFromStatements(ss statements, w io.Writer) error {
+	globalKeys, sections, sectionOrder, emptyOnlySections := indexStatements(ss)
+	if len(globalKeys) > 0 {
+		return fmt.Errorf("setting %q is not in a section, as systemd requires", globalKeys[0].key)
+	}
+	comments, sectionComments := indexComments(ss)
+
+	first := true
+	for _, secName := range sectionOrder {
+		kvs := sections[secName]
+		if len(kvs) == 0 && !emptyOnlySections[secName] {
+			continue
+		}
+		if !first {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		first = false
+		if err := writeComment(w, sectionComments[secName]); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "[%s]\n", secName); err != nil {
+			return err
+		}
+		for _, kv := range kvs {
+			if err := checkINIKey(kv.key); err != nil {
+				return err
+			}
+			if err := writeComment(w, comments[kv.commentKey()]); err != nil {
+				return err
+			}
+			value := strings.ReplaceAll(kv.value, "\n", " \\\n    ")
+			if _, err := fmt.Fprintf(w, "%s=%s\n", kv.key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return writeComment(w, sectionComments[""])
+}
+
+// systemdSetting is the effective value of one setting of a unit.
+type systemdSetting struct {
+	path    statement
+	values  []string
+	origins []string
+}
+
+// mergeSystemdUnits merges a unit file with its drop-ins into the settings
+// systemd would use, given as layers in the order systemd applies them.
+// A list setting accumulates the values assigned to it and other settings
+// take the last value assigned; an empty assignment resets either. Lists
+// of more than one value are given indexes. names holds the name of each
+// layer, used by showOrigin to attach a comment naming the file that
+// supplied each value. Comments in the files are dropped.
+func mergeSystemdUnits(layers []statements, names []string, showOrigin bool) statements {
+	var order []string
+	sections := make(map[string]statement)
+	settings := make(map[string]*systemdSetting)
+
+	for i, layer := range layers {
+		for _, s := range layer {
+			path, value, ok := splitAssignment(s)
+			if !ok {
+				continue
+			}
+			path = withoutIndex(path)
+			id := statementToString(path)
+			if value.typ == typEmptyObject {
+				if _, seen := sections[id]; !seen {
+					sections[id] = path
+					order = append(order, id)
+				}
+				continue
+			}
+
+			st, seen := settings[id]
+			if !seen {
+				st = &systemdSetting{path: path}
+				settings[id] = st
+				order = append(order, id)
+			}
+			v := unquoteString(value.text)
+			parts, _, _ := extractPathAndValue(s)
+			switch {
+			case v == "":
+				st.values, st.origins = nil, nil
+			case !isSystemdListKey(parts[len(parts)-1]):
+				st.values, st.origins = []string{v}, []string{names[i]}
+			default:
+				st.values, st.origins = append(st.values, v), append(st.origins, names[i])
+			}
+		}
+	}
+
+	var merged statements
+	for _, id := range order {
+		if path, ok := sections[id]; ok {
+			merged = append(merged, path.withEmptyObject())
+			continue
+		}
+		st := settings[id]
+		for j, v := range st.values {
+			path := st.path
+			if len(st.values) > 1 {
+				path = path.withIndex(j)
+			}
+			if showOrigin {
+				merged = append(merged, path.withComment(st.origins[j]))
+			}
+			merged = append(merged, path.withStringValue(v))
+		}
+	}
+	return merged
+}
+
+// readSystemdUnits returns the reader that --merge uses for systemd units:
+// it reads each of inputs with read, followed by its drop-ins, the .conf
+// files in the directory named after it with a .d suffix, and merges them
+// with mergeSystemdUnits.
+func readSystemdUnits(read readerFn, inputs []namedInput) readerFn {
+	return func(_ io.Reader, opts int) (statements, error) {
+		var layers []statements
+		var names []string
+		for _, in := range inputs {
+			units, err := withDropIns(in)
+			if err != nil {
+				return nil, err
+			}
+			for _, u := range units {
+				ss, err := readInput(read, u, opts)
+				if err != nil {
+					return nil, err
+				}
+				layers = append(layers, ss)
+				names = append(names, u.name)
+			}
+		}
+		return mergeSystemdUnits(layers, names, opts&optShowOrigin > 0), nil
+	}
+}
+
+// withDropIns returns in followed by its drop-ins in lexical order, as
+// systemd applies them. Standard input has none.
+func withDropIns(in namedInput) ([]namedInput, error) {
+	path := in.path
+	if path == "" {
+		path = in.name
+	}
+	if path == "-" {
+		return []namedInput{in}, nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(path+".d", "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	units := []namedInput{in}
+	for _, m := range matches {
+		units = append(units, namedInput{name: m, path: m})
+	}
+	return units, nil
+}
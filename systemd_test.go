@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const systemdUnit = `# The web server
+[Unit]
+Description="Web server"
+After=network.target
+After=syslog.target
+
+[Service]
+ExecStartPre=/bin/mkdir -p /run/web
+ExecStart=/usr/bin/web \
+    --port 8080 \
+    # not part of the command
+    --verbose
+Restart=no
+ExecStartPre=
+`
+
+func TestStatementsFromSystemd(t *testing.T) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromSystemd(strings.NewReader(systemdUnit), prefix, optComments)
+	if err != nil {
+		t.Fatalf("statementsFromSystemd error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.Unit # "# The web server";`,
+		`ini.Unit = {};`,
+		`ini.Unit.Description = "\"Web server\"";`,
+		`ini.Unit.After[0] = "network.target";`,
+		`ini.Unit.After[1] = "syslog.target";`,
+		`ini.Service = {};`,
+		`ini.Service.ExecStartPre[0] = "/bin/mkdir -p /run/web";`,
+		`ini.Service.ExecStart = "/usr/bin/web --port 8080 --verbose";`,
+		`ini.Service.Restart = "no";`,
+		`ini.Service.ExecStartPre[1] = "";`,
+	}
+
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestStatementsFromSystemdErrors(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{"setting outside a section", "Description=x\n"},
+		{"unclosed header", "[Unit\n"},
+		{"missing equals", "[Unit]\nDescription\n"},
+		{"empty key", "[Unit]\n=x\n"},
+	}
+
+	prefix := statement{{text: "ini", typ: typBare}}
+	for _, tt := range tests {
+		if _, err := statementsFromSystemd(strings.NewReader(tt.input), prefix, 0); err == nil {
+			t.Errorf("%s: expected error, got nil", tt.desc)
+		}
+	}
+}
+
+func TestSystemdFromStatements(t *testing.T) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromSystemd(strings.NewReader(systemdUnit), prefix, optComments)
+	if err != nil {
+		t.Fatalf("statementsFromSystemd error: %v", err)
+	}
+	ss = append(ss, prefix.withBare("Service").withBare("Environment").withStringValue("A=1\nB=2"))
+
+	var buf bytes.Buffer
+	if err := systemdFromStatements(ss, &buf); err != nil {
+		t.Fatalf("systemdFromStatements error: %v", err)
+	}
+
+	want := `# The web server
+[Unit]
+Description="Web server"
+After=network.target
+After=syslog.target
+
+[Service]
+ExecStartPre=/bin/mkdir -p /run/web
+ExecStartPre=
+ExecStart=/usr/bin/web --port 8080 --verbose
+Restart=no
+Environment=A=1 \
+    B=2
+`
+	if buf.String() != want {
+		t.Errorf("systemd output:\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	global := statements{prefix.withBare("Description").withStringValue("x")}
+	if err := systemdFromStatements(global, &buf); err == nil {
+		t.Error("expected error for a setting outside a section, got nil")
+	}
+}
+
+func TestMergeSystemdUnits(t *testing.T) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	read := func(input string) statements {
+		ss, err := statementsFromSystemd(strings.NewReader(input), prefix, optComments)
+		if err != nil {
+			t.Fatalf("statementsFromSystemd error: %v", err)
+		}
+		return ss
+	}
+
+	layers := []statements{
+		read(systemdUnit),
+		read("[Service]\nExecStart=\nExecStart=/usr/bin/web --port 9090\nRestart=always\nExecStartPre=/bin/true\n"),
+		read("[Unit]\nAfter=\n[Service]\nUser=web\n"),
+	}
+	names := []string{"web.service", "web.service.d/10-port.conf", "web.service.d/20-user.conf"}
+
+	tests := []struct {
+		showOrigin bool
+		want       []string
+	}{
+		{false, []string{
+			`ini = {};`,
+			`ini.Unit = {};`,
+			`ini.Unit.Description = "\"Web server\"";`,
+			`ini.Service = {};`,
+			`ini.Service.ExecStartPre = "/bin/true";`,
+			`ini.Service.ExecStart = "/usr/bin/web --port 9090";`,
+			`ini.Service.Restart = "always";`,
+			`ini.Service.User = "web";`,
+		}},
+		{true, []string{
+			`ini = {};`,
+			`ini.Unit = {};`,
+			`ini.Unit.Description # "web.service";`,
+			`ini.Unit.Description = "\"Web server\"";`,
+			`ini.Service = {};`,
+			`ini.Service.ExecStartPre # "web.service.d/10-port.conf";`,
+			`ini.Service.ExecStartPre = "/bin/true";`,
+			`ini.Service.ExecStart # "web.service.d/10-port.conf";`,
+			`ini.Service.ExecStart = "/usr/bin/web --port 9090";`,
+			`ini.Service.Restart # "web.service.d/10-port.conf";`,
+			`ini.Service.Restart = "always";`,
+			`ini.Service.User # "web.service.d/20-user.conf";`,
+			`ini.Service.User = "web";`,
+		}},
+	}
+
+	for _, tt := range tests {
+		merged := mergeSystemdUnits(layers, names, tt.showOrigin)
+		if len(merged) != len(tt.want) {
+			t.Fatalf("showOrigin %v: got %d statements, want %d", tt.showOrigin, len(merged), len(tt.want))
+		}
+		for i, s := range merged {
+			if got := statementToString(s); got != tt.want[i] {
+				t.Errorf("showOrigin %v: statement %d: got %q, want %q", tt.showOrigin, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestMergeSystemdUnitsLists(t *testing.T) {
+	prefix := statement{{text: "ini", typ: typBare}}
+	unit, err := statementsFromSystemd(strings.NewReader("[Unit]\nAfter=a.target\n"), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromSystemd error: %v", err)
+	}
+	dropIn, err := statementsFromSystemd(strings.NewReader("[Unit]\nAfter=b.target\nConditionPathExists=/etc/web\n"), prefix, 0)
+	if err != nil {
+		t.Fatalf("statementsFromSystemd error: %v", err)
+	}
+
+	merged := mergeSystemdUnits([]statements{unit, dropIn}, []string{"a", "b"}, false)
+	want := []string{
+		`ini = {};`,
+		`ini.Unit = {};`,
+		`ini.Unit.After[0] = "a.target";`,
+		`ini.Unit.After[1] = "b.target";`,
+		`ini.Unit.ConditionPathExists = "/etc/web";`,
+	}
+	if len(merged) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(merged), len(want))
+	}
+	for i, s := range merged {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestInputsReaderSystemdDropIns(t *testing.T) {
+	dir := t.TempDir()
+	unit := filepath.Join(dir, "web.service")
+	files := map[string]string{
+		unit: "[Service]\nRestart=no\nUser=nobody\n",
+		filepath.Join(dir, "web.service.d", "20-user.conf"):    "[Service]\nUser=web\n",
+		filepath.Join(dir, "web.service.d", "10-restart.conf"): "[Service]\nRestart=always\nUser=root\n",
+		filepath.Join(dir, "web.service.d", "notes.txt"):       "ignored",
+	}
+	if err := os.Mkdir(filepath.Join(dir, "web.service.d"), 0o755); err != nil {
+		t.Fatalf("Mkdir error: %v", err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile error: %v", err)
+		}
+	}
+
+	inputs := []namedInput{{name: unit, path: unit}}
+	read, opts := inputsReader(readSystemd, inputs, "systemd", optMerge, nil)
+	ss, err := read(nil, opts)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.Service = {};`,
+		`ini.Service.Restart = "always";`,
+		`ini.Service.User = "web";`,
+	}
+	if len(ss) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
@@ -13,10 +14,21 @@ type tokenTyp int
 const (
 	typBare        tokenTyp = iota // Bare identifier: ini, section, key
 	typDot                         // .
+	typLBrace                      // [
+	typRBrace                      // ]
+	typNumericKey                  // 0, 1, 2 (index of a repeated key)
+	typQuotedKey                   // "key that is not a valid identifier"
 	typEquals                      // =
 	typSemi                        // ;
 	typString                      // "quoted value"
+	typNumber                      // 5432, an unquoted number value (--types)
+	typBoolean                     // yes, an unquoted boolean value (--types)
 	typEmptyObject                 // {}
+	typHash                        // # (introduces a comment statement)
+	typAt                          // @ (introduces an attribute of a key)
+	typAttribute                   // attribute name, such as continuation
+	typComment                     // "quoted comment text"
+	typPosition                    // trailing "// app.ini:42" source position
 	typIgnored                     // grep separator lines like --
 	typError                       // parse error
 )
@@ -27,18 +39,30 @@ type token struct {
 }
 
 func (t token) isValue() bool {
-	return t.typ == typString || t.typ == typEmptyObject
+	return t.isScalar() || t.typ == typEmptyObject
+}
+
+// isScalar reports whether t is a string, number or boolean value.
+func (t token) isScalar() bool {
+	return t.typ == typString || t.typ == typNumber || t.typ == typBoolean
 }
 
 func (t token) isPunct() bool {
-	return t.typ == typDot || t.typ == typEquals || t.typ == typSemi
+	switch t.typ {
+	case typDot, typLBrace, typRBrace, typEquals, typHash, typAt, typSemi:
+		return true
+	default:
+		return false
+	}
 }
 
 var (
-	bareColor  = color.New(color.FgBlue, color.Bold)
-	strColor   = color.New(color.FgYellow)
-	braceColor = color.New(color.FgMagenta)
-	punctColor = color.New(color.FgRed)
+	bareColor    = color.New(color.FgBlue, color.Bold)
+	strColor     = color.New(color.FgYellow)
+	literalColor = color.New(color.FgCyan)
+	braceColor   = color.New(color.FgMagenta)
+	punctColor   = color.New(color.FgRed)
+	commentColor = color.New(color.FgHiBlack)
 )
 
 func (t token) format() string {
@@ -47,13 +71,17 @@ func (t token) format() string {
 
 func (t token) formatColor() string {
 	switch t.typ {
-	case typBare:
+	case typBare, typNumericKey, typQuotedKey:
 		return bareColor.Sprint(t.text)
 	case typString:
 		return strColor.Sprint(t.text)
+	case typNumber, typBoolean:
+		return literalColor.Sprint(t.text)
 	case typEmptyObject:
 		return braceColor.Sprint(t.text)
-	case typDot, typEquals, typSemi:
+	case typComment, typPosition, typAttribute:
+		return commentColor.Sprint(t.text)
+	case typDot, typLBrace, typRBrace, typEquals, typHash, typAt, typSemi:
 		return punctColor.Sprint(t.text)
 	default:
 		return t.text
@@ -129,3 +157,72 @@ func unquoteString(s string) string {
 	}
 	return b.String()
 }
+
+// booleanValues maps the words that --types reads as booleans, in lower
+// case, to the truth they stand for.
+var booleanValues = map[string]bool{
+	"true":  true,
+	"yes":   true,
+	"on":    true,
+	"false": false,
+	"no":    false,
+	"off":   false,
+}
+
+// booleanValue returns the truth that s stands for, in any case, such as
+// true for On. ok is false if s is not a boolean word.
+func booleanValue(s string) (b, ok bool) {
+	b, ok = booleanValues[strings.ToLower(s)]
+	return b, ok
+}
+
+// valueToken returns the value token for val: with types, an unquoted
+// number or boolean if val reads as one, and a quoted string otherwise.
+func valueToken(val string, types bool) token {
+	_, isBoolean := booleanValue(val)
+	switch {
+	case types && isNumber(val):
+		return token{val, typNumber}
+	case types && isBoolean:
+		return token{val, typBoolean}
+	}
+	return token{quoteString(val), typString}
+}
+
+// isNumber reports whether s is a decimal integer or float written as
+// JSON writes them, such as -17, 0.5 or 6.626e-34. Integers must fit in 64
+// bits so that every typed format can hold them, and numbers with leading
+// zeros, such as 0755, are not numbers.
+func isNumber(s string) bool {
+	if !isNumberSyntax(s) {
+		return false
+	}
+	if strings.ContainsAny(s, ".eE") {
+		return true
+	}
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+// isNumberSyntax reports whether s follows the syntax of a JSON number.
+func isNumberSyntax(s string) bool {
+	mantissa, exponent, hasExponent := strings.Cut(strings.ToLower(strings.TrimPrefix(s, "-")), "e")
+	whole, frac, hasFrac := strings.Cut(mantissa, ".")
+	switch {
+	case !isDecimalDigits(whole) || len(whole) > 1 && whole[0] == '0':
+		return false
+	case hasFrac && !isDecimalDigits(frac):
+		return false
+	case hasExponent:
+		if exponent != "" && (exponent[0] == '+' || exponent[0] == '-') {
+			exponent = exponent[1:]
+		}
+		return isDecimalDigits(exponent)
+	}
+	return true
+}
+
+// isDecimalDigits reports whether s is one or more decimal digits.
+func isDecimalDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
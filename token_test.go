@@ -11,11 +11,15 @@ func TestTokenIsValue(t *testing.T) {
 	}{
 		{token{"\"hello\"", typString}, true},
 		{token{"{}", typEmptyObject}, true},
+		{token{"5432", typNumber}, true},
+		{token{"yes", typBoolean}, true},
 		{token{"ini", typBare}, false},
 		{token{".", typDot}, false},
 		{token{"=", typEquals}, false},
 		{token{";", typSemi}, false},
 		{token{"--", typIgnored}, false},
+		{token{"# ", typHash}, false},
+		{token{"\"; note\"", typComment}, false},
 		{token{"err", typError}, false},
 	}
 
@@ -34,6 +38,7 @@ func TestTokenIsPunct(t *testing.T) {
 		{token{".", typDot}, true},
 		{token{"=", typEquals}, true},
 		{token{";", typSemi}, true},
+		{token{" # ", typHash}, true},
 		{token{"ini", typBare}, false},
 		{token{"\"hello\"", typString}, false},
 		{token{"{}", typEmptyObject}, false},
@@ -118,3 +123,63 @@ func TestQuoteUnquoteRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestValueToken(t *testing.T) {
+	tests := []struct {
+		val   string
+		types bool
+		want  token
+	}{
+		{"5432", false, token{`"5432"`, typString}},
+		{"5432", true, token{"5432", typNumber}},
+		{"-1.5e3", true, token{"-1.5e3", typNumber}},
+		{"yes", false, token{`"yes"`, typString}},
+		{"yes", true, token{"yes", typBoolean}},
+		{"off", true, token{"off", typBoolean}},
+		{"True", true, token{"True", typBoolean}},
+		{"OFF", true, token{"OFF", typBoolean}},
+		{"Truth", true, token{`"Truth"`, typString}},
+		{"0755", true, token{`"0755"`, typString}},
+		{"", true, token{`""`, typString}},
+		{"localhost", true, token{`"localhost"`, typString}},
+	}
+
+	for _, tt := range tests {
+		if got := valueToken(tt.val, tt.types); got != tt.want {
+			t.Errorf("valueToken(%q, %v) = %v, want %v", tt.val, tt.types, got, tt.want)
+		}
+	}
+}
+
+func TestIsNumber(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"0", true},
+		{"5432", true},
+		{"-17", true},
+		{"0.5", true},
+		{"6.626e-34", true},
+		{"1E+3", true},
+		{"9223372036854775807", true},
+		{"9223372036854775808", false},
+		{"0755", false},
+		{"-0", true},
+		{"+1", false},
+		{".5", false},
+		{"1.", false},
+		{"1e", false},
+		{"1_000", false},
+		{"0x1F", false},
+		{"inf", false},
+		{"", false},
+		{"-", false},
+	}
+
+	for _, tt := range tests {
+		if got := isNumber(tt.s); got != tt.want {
+			t.Errorf("isNumber(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,764 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tomlEscapes maps the characters that may follow a backslash in a TOML
+// basic string to the characters they stand for. \uXXXX and \UXXXXXXXX
+// escapes are decoded separately.
+var tomlEscapes = map[byte]byte{
+	'b':  '\b',
+	't':  '\t',
+	'n':  '\n',
+	'f':  '\f',
+	'r':  '\r',
+	'"':  '"',
+	'\\': '\\',
+}
+
+// tomlEntry is a key read from a TOML document, along with the key path
+// of the table it belongs in. An entry for an inline table has no key.
+type tomlEntry struct {
+	table   []string
+	pair    iniKVPair
+	isTable bool
+}
+
+// tomlReader holds the state of parsing a TOML document.
+type tomlReader struct {
+	src  string
+	pos  int
+	line int
+	data iniData
+	// sections maps the names under which data stores tables to their
+	// key paths.
+	sections map[string][]string
+	// table is the key path of the table that keys are added to.
+	table []string
+	// values holds the dotted names of the keys set so far.
+	values         map[string]bool
+	pendingComment []string
+}
+
+// statementsFromTOML reads a TOML document from r and produces grin
+// statements rooted at prefix. Tables, including dotted keys and inline
+// tables, become sections, and arrays of scalars become repeated keys.
+// Strings are unescaped, integers are written in decimal, and floats,
+// booleans and dates are kept as they are written. Arrays of tables and
+// arrays holding tables or other arrays have no INI equivalent and are
+// rejected, as are keys set twice.
+func statementsFromTOML(r io.Reader, prefix statement, opts int) (statements, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+
+	t := &tomlReader{
+		src:  stripBOM(string(src)),
+		line: 1,
+		data: iniData{
+			sectionKeys:     make(map[string][]iniKVPair),
+			sectionComments: make(map[string]string),
+			sectionLines:    make(map[string]int),
+		},
+		sections: make(map[string][]string),
+		values:   make(map[string]bool),
+	}
+	t.data.sectionPath = t.sectionPath
+
+	for t.skipLines(true); t.pos < len(t.src); t.skipLines(true) {
+		if err := t.readLine(); err != nil {
+			return nil, err
+		}
+	}
+	t.data.trailingComment = t.takeComment()
+
+	return buildINIStatements(prefix, &t.data, opts), nil
+}
+
+// sectionPath returns the paths of the table stored under name and of the
+// tables it is nested in.
+func (t *tomlReader) sectionPath(prefix statement, name string) []statement {
+	parts := t.sections[name]
+	paths := make([]statement, len(parts))
+	for i := range parts {
+		paths[i] = prefix.withKeys(parts[:i+1])
+	}
+	return paths
+}
+
+// peek returns the byte at the current position, or 0 at the end.
+func (t *tomlReader) peek() byte {
+	if t.pos >= len(t.src) {
+		return 0
+	}
+	return t.src[t.pos]
+}
+
+// skipBlank skips spaces and tabs.
+func (t *tomlReader) skipBlank() {
+	for t.peek() == ' ' || t.peek() == '\t' {
+		t.pos++
+	}
+}
+
+// skipLines skips whitespace, line breaks and comments, keeping the
+// comments for the next key or table if keep is set.
+func (t *tomlReader) skipLines(keep bool) {
+	for {
+		t.skipBlank()
+		switch {
+		case strings.HasPrefix(t.src[t.pos:], "\r\n"):
+			t.pos += 2
+			t.line++
+		case t.peek() == '\n':
+			t.pos++
+			t.line++
+		case t.peek() == '#':
+			if comment := t.readComment(); keep {
+				t.pendingComment = append(t.pendingComment, comment)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// readComment reads a comment up to the end of its line.
+func (t *tomlReader) readComment() string {
+	start := t.pos
+	for t.pos < len(t.src) && t.src[t.pos] != '\n' {
+		t.pos++
+	}
+	return strings.TrimSpace(t.src[start:t.pos])
+}
+
+// takeComment returns the comment lines read since the last key or
+// table, clearing them.
+func (t *tomlReader) takeComment() string {
+	comment := strings.Join(t.pendingComment, "\n")
+	t.pendingComment = nil
+	return comment
+}
+
+// endLine reads the end of a line after a key or table header, returning
+// the comment on it if there is one.
+func (t *tomlReader) endLine() (string, error) {
+	t.skipBlank()
+	var comment string
+	if t.peek() == '#' {
+		comment = t.readComment()
+	}
+	switch {
+	case t.pos == len(t.src):
+	case strings.HasPrefix(t.src[t.pos:], "\r\n"):
+		t.pos += 2
+		t.line++
+	case t.peek() == '\n':
+		t.pos++
+		t.line++
+	default:
+		rest, _, _ := strings.Cut(t.src[t.pos:], "\n")
+		return "", fmt.Errorf("line %d: unexpected %q", t.line, strings.TrimSpace(rest))
+	}
+	return comment, nil
+}
+
+// readLine reads a table header or a key and its value.
+func (t *tomlReader) readLine() error {
+	line := t.line
+	if t.peek() == '[' {
+		return t.readTable()
+	}
+
+	entries, err := t.readKeyValue(t.table)
+	if err != nil {
+		return err
+	}
+	comment := t.takeComment()
+	inline, err := t.endLine()
+	if err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		if e.isTable {
+			t.addTable(e.table, comment, line)
+			comment = ""
+			continue
+		}
+		name := t.addTable(e.table, "", line)
+		e.pair.comment, comment = comment, ""
+		if i == len(entries)-1 {
+			e.pair.inlineComment = inline
+		}
+		t.data.addKey(name, e.pair)
+	}
+	return nil
+}
+
+// readTable reads a table header such as [database.pool].
+func (t *tomlReader) readTable() error {
+	line := t.line
+	t.pos++
+	if t.peek() == '[' {
+		return fmt.Errorf("line %d: arrays of tables are not supported", line)
+	}
+	t.skipBlank()
+	path, err := t.readKey()
+	if err != nil {
+		return err
+	}
+	t.skipBlank()
+	if t.peek() != ']' {
+		return fmt.Errorf("line %d: expected ']' after table name", line)
+	}
+	t.pos++
+
+	comment := t.takeComment()
+	inline, err := t.endLine()
+	if err != nil {
+		return err
+	}
+	if t.values[tomlKeyPath(path)] {
+		return fmt.Errorf("line %d: %s is already a value", line, tomlKeyPath(path))
+	}
+	t.table = path
+	t.addTable(path, joinComments(comment, inline), line)
+	return nil
+}
+
+// addTable records the table at path, returning the name it is stored
+// under. The root table is stored as "".
+func (t *tomlReader) addTable(path []string, comment string, line int) string {
+	if len(path) == 0 {
+		return ""
+	}
+	name := tomlKeyPath(path)
+	t.sections[name] = path
+	t.data.addSection(name, comment, line)
+	return name
+}
+
+// readKey reads a key, whose dotted parts may be bare or quoted, and
+// returns its parts.
+func (t *tomlReader) readKey() ([]string, error) {
+	var parts []string
+	for {
+		var part string
+		var err error
+		switch c := t.peek(); {
+		case c == '"':
+			part, err = t.readBasicString()
+		case c == '\'':
+			part, err = t.readLiteralString()
+		default:
+			start := t.pos
+			for t.pos < len(t.src) && isTOMLBareKeyChar(t.src[t.pos]) {
+				t.pos++
+			}
+			if part = t.src[start:t.pos]; part == "" {
+				return nil, fmt.Errorf("line %d: expected a key", t.line)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+
+		t.skipBlank()
+		if t.peek() != '.' {
+			return parts, nil
+		}
+		t.pos++
+		t.skipBlank()
+	}
+}
+
+// readKeyValue reads a key and its value in the table at table, returning
+// an entry for each key it sets and each table it opens.
+func (t *tomlReader) readKeyValue(table []string) ([]tomlEntry, error) {
+	line := t.line
+	path, err := t.readKey()
+	if err != nil {
+		return nil, err
+	}
+	t.skipBlank()
+	if t.peek() != '=' {
+		return nil, fmt.Errorf("line %d: expected '=' after key", line)
+	}
+	t.pos++
+	t.skipBlank()
+
+	parent := append(append([]string{}, table...), path[:len(path)-1]...)
+	key := path[len(path)-1]
+	full := tomlKeyPath(append(append([]string{}, parent...), key))
+	if t.values[full] || t.sections[full] != nil {
+		return nil, fmt.Errorf("line %d: %s is set twice", line, full)
+	}
+	for i := range parent {
+		if name := tomlKeyPath(parent[:i+1]); t.values[name] {
+			return nil, fmt.Errorf("line %d: %s is already a value", line, name)
+		}
+	}
+	if t.peek() == '{' {
+		return t.readInlineTable(append(parent, key))
+	}
+	t.values[full] = true
+
+	switch t.peek() {
+	case '[':
+		values, err := t.readArray()
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("line %d: %s: empty arrays are not supported", line, full)
+		}
+		entries := make([]tomlEntry, len(values))
+		for i, v := range values {
+			entries[i] = tomlEntry{table: parent, pair: iniKVPair{key: key, value: v, line: line, delimiter: "=", array: true}}
+		}
+		return entries, nil
+	}
+
+	value, err := t.readScalar()
+	if err != nil {
+		return nil, err
+	}
+	return []tomlEntry{{table: parent, pair: iniKVPair{key: key, value: value, line: line, delimiter: "="}}}, nil
+}
+
+// readInlineTable reads an inline table such as { min = 5, max = 20 },
+// which becomes the table at path.
+func (t *tomlReader) readInlineTable(path []string) ([]tomlEntry, error) {
+	entries := []tomlEntry{{table: path, isTable: true}}
+	t.pos++
+	t.skipBlank()
+	if t.peek() == '}' {
+		t.pos++
+		return entries, nil
+	}
+	for {
+		kvs, err := t.readKeyValue(path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, kvs...)
+
+		t.skipBlank()
+		switch t.peek() {
+		case ',':
+			t.pos++
+			t.skipBlank()
+		case '}':
+			t.pos++
+			return entries, nil
+		default:
+			return nil, fmt.Errorf("line %d: expected ',' or '}' in inline table", t.line)
+		}
+	}
+}
+
+// readArray reads an array of scalars, which may span lines and hold
+// comments, returning its values.
+func (t *tomlReader) readArray() ([]string, error) {
+	t.pos++
+	var values []string
+	for {
+		t.skipLines(false)
+		switch t.peek() {
+		case ']':
+			t.pos++
+			return values, nil
+		case '[', '{':
+			return nil, fmt.Errorf("line %d: arrays may only hold strings, numbers, booleans and dates", t.line)
+		}
+		value, err := t.readScalar()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		t.skipLines(false)
+		switch t.peek() {
+		case ',':
+			t.pos++
+		case ']':
+			t.pos++
+			return values, nil
+		default:
+			return nil, fmt.Errorf("line %d: expected ',' or ']' in array", t.line)
+		}
+	}
+}
+
+// readScalar reads a string, number, boolean or date, returning it as
+// the text of an INI value.
+func (t *tomlReader) readScalar() (string, error) {
+	switch {
+	case strings.HasPrefix(t.src[t.pos:], `"""`):
+		return t.readMultilineString(`"""`)
+	case strings.HasPrefix(t.src[t.pos:], `'''`):
+		return t.readMultilineString(`'''`)
+	case t.peek() == '"':
+		return t.readBasicString()
+	case t.peek() == '\'':
+		return t.readLiteralString()
+	}
+
+	start := t.pos
+	for t.pos < len(t.src) && !strings.ContainsRune(" \t\r\n,]}#", rune(t.src[t.pos])) {
+		t.pos++
+	}
+	// A space may separate the date and time of a date-time
+	if t.pos-start == len("2006-01-02") && strings.HasPrefix(t.src[t.pos:], " ") &&
+		len(t.src) > t.pos+3 && t.src[t.pos+3] == ':' {
+		t.pos++
+		for t.pos < len(t.src) && !strings.ContainsRune(" \t\r\n,]}#", rune(t.src[t.pos])) {
+			t.pos++
+		}
+	}
+	return parseTOMLScalar(t.src[start:t.pos], t.line)
+}
+
+// parseTOMLScalar converts the text of a boolean, number or date into the
+// text of an INI value.
+func parseTOMLScalar(text string, lineNum int) (string, error) {
+	if text == "true" || text == "false" || isTOMLDateTime(text) {
+		return text, nil
+	}
+	if n, ok := parseTOMLNumber(text); ok {
+		return n, nil
+	}
+	if text == "" {
+		return "", fmt.Errorf("line %d: expected a value", lineNum)
+	}
+	return "", fmt.Errorf("line %d: invalid value %q", lineNum, text)
+}
+
+// parseTOMLNumber converts the text of a TOML integer to decimal, and
+// removes the underscores from that of a float.
+func parseTOMLNumber(text string) (string, bool) {
+	digits := strings.TrimLeft(text, "+-")
+	switch {
+	case strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0o") || strings.HasPrefix(text, "0b"):
+		n, err := strconv.ParseInt(text, 0, 64)
+		return strconv.FormatInt(n, 10), err == nil
+	case digits == "inf" || digits == "nan":
+		return text, true
+	case len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9':
+		// Leading zeros are not allowed
+		return "", false
+	case strings.Trim(digits, "0123456789_") == "":
+		n, err := strconv.ParseInt(strings.ReplaceAll(text, "_", ""), 10, 64)
+		return strconv.FormatInt(n, 10), err == nil
+	}
+	f := strings.ReplaceAll(text, "_", "")
+	_, err := strconv.ParseFloat(f, 64)
+	return f, err == nil && strings.Trim(digits, "0123456789_.eE+-") == ""
+}
+
+// isTOMLDateTime reports whether text looks like a TOML date, time or
+// date-time, such as 1979-05-27, 07:32:00 or 1979-05-27T07:32:00Z.
+func isTOMLDateTime(text string) bool {
+	isDate := len(text) >= 10 && text[4] == '-' && text[7] == '-'
+	isTime := len(text) >= 8 && text[2] == ':' && text[5] == ':'
+	return (isDate || isTime) && strings.Trim(text, "0123456789-:.TtZz+ ") == ""
+}
+
+// readBasicString reads a string in double quotes, decoding its escapes.
+func (t *tomlReader) readBasicString() (string, error) {
+	var b strings.Builder
+	for t.pos++; t.pos < len(t.src); t.pos++ {
+		switch c := t.src[t.pos]; c {
+		case '"':
+			t.pos++
+			return b.String(), nil
+		case '\n':
+			return "", fmt.Errorf("line %d: unterminated string", t.line)
+		case '\\':
+			if err := t.readEscape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("line %d: unterminated string", t.line)
+}
+
+// readLiteralString reads a string in single quotes, which has no escapes.
+func (t *tomlReader) readLiteralString() (string, error) {
+	end := strings.IndexAny(t.src[t.pos+1:], "'\n")
+	if end == -1 || t.src[t.pos+1+end] != '\'' {
+		return "", fmt.Errorf("line %d: unterminated string", t.line)
+	}
+	s := t.src[t.pos+1 : t.pos+1+end]
+	t.pos += end + 2
+	return s, nil
+}
+
+// readMultilineString reads a string between triple quotes, delim, that
+// may span lines. A line break straight after the opening delimiter is left
+// out, and in a basic string, a backslash at the end of a line removes
+// the line break and the whitespace that follows it.
+func (t *tomlReader) readMultilineString(delim string) (string, error) {
+	start := t.line
+	t.pos += len(delim)
+	if strings.HasPrefix(t.src[t.pos:], "\r\n") {
+		t.pos++
+	}
+	if t.peek() == '\n' {
+		t.pos++
+		t.line++
+	}
+
+	var b strings.Builder
+	for t.pos < len(t.src) {
+		switch c := t.src[t.pos]; {
+		case strings.HasPrefix(t.src[t.pos:], delim):
+			// Up to two quotes may come before the closing ones
+			for i := 0; i < 2 && strings.HasPrefix(t.src[t.pos+1:], delim); i++ {
+				b.WriteByte(c)
+				t.pos++
+			}
+			t.pos += len(delim)
+			return b.String(), nil
+		case c == '\\' && delim == `"""`:
+			if err := t.readMultilineEscape(&b); err != nil {
+				return "", err
+			}
+		default:
+			if c == '\n' {
+				t.line++
+			}
+			b.WriteByte(c)
+			t.pos++
+		}
+	}
+	return "", fmt.Errorf("line %d: unterminated string", start)
+}
+
+// readMultilineEscape decodes the escape that starts at the backslash at
+// the current position of a multi-line basic string into b, moving past
+// it. A backslash at the end of a line removes the line break and the
+// whitespace after it.
+func (t *tomlReader) readMultilineEscape(b *strings.Builder) error {
+	rest := strings.TrimLeft(t.src[t.pos+1:], " \t\r")
+	if !strings.HasPrefix(rest, "\n") {
+		err := t.readEscape(b)
+		t.pos++
+		return err
+	}
+	for t.pos++; t.pos < len(t.src) && strings.ContainsRune(" \t\r\n", rune(t.src[t.pos])); t.pos++ {
+		if t.src[t.pos] == '\n' {
+			t.line++
+		}
+	}
+	return nil
+}
+
+// readEscape decodes the escape that starts at the backslash at the
+// current position into b, leaving the position on its last character.
+func (t *tomlReader) readEscape(b *strings.Builder) error {
+	if t.pos+1 >= len(t.src) {
+		return fmt.Errorf("line %d: unterminated string", t.line)
+	}
+	t.pos++
+	c := t.src[t.pos]
+	if esc, ok := tomlEscapes[c]; ok {
+		b.WriteByte(esc)
+		return nil
+	}
+
+	n := map[byte]int{'u': 4, 'U': 8}[c]
+	if n == 0 {
+		return fmt.Errorf("line %d: invalid escape \\%c", t.line, c)
+	}
+	if t.pos+n >= len(t.src) {
+		return fmt.Errorf("line %d: malformed \\%c escape", t.line, c)
+	}
+	code, err := strconv.ParseUint(t.src[t.pos+1:t.pos+1+n], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return fmt.Errorf("line %d: malformed \\%c escape %q", t.line, c, t.src[t.pos-1:t.pos+1+n])
+	}
+	b.WriteRune(rune(code))
+	t.pos += n
+	return nil
+}
+
+// isTOMLBareKeyChar reports whether c may appear in a bare TOML key.
+func isTOMLBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// tomlKey returns k as a TOML key: bare if it can be, quoted otherwise.
+func tomlKey(k string) string {
+	for i := 0; i < len(k); i++ {
+		if !isTOMLBareKeyChar(k[i]) {
+			return tomlString(k)
+		}
+	}
+	if k == "" {
+		return `""`
+	}
+	return k
+}
+
+// tomlKeyPath returns the dotted TOML key for the parts of a path, as in
+// database.pool or servers."example.com".
+func tomlKeyPath(parts []string) string {
+	keys := make([]string, len(parts))
+	for i, p := range parts {
+		keys[i] = tomlKey(p)
+	}
+	return strings.Join(keys, ".")
+}
+
+// tomlString quotes s as a TOML basic string. TOML shares grin's escapes
+// but also requires DEL to be escaped.
+func tomlString(s string) string {
+	return strings.ReplaceAll(quoteString(s), "\x7f", `\u007f`)
+}
+
+// tomlWriter holds what writing a TOML document needs to know about the
+// statements being written.
+type tomlWriter struct {
+	w        io.Writer
+	comments map[string]string
+	attrs    map[string]map[string]string
+	// sectionComments holds the comments of the tables, by dotted name.
+	sectionComments map[string]string
+	// tables holds the dotted names of the sections, which no key may
+	// share.
+	tables map[string]bool
+	types  bool
+}
+
+// tomlFromStatements writes statements as a TOML document. Global keys
+// come first, then each section as a table such as [database.pool], with
+// the keys of a repeated key gathered into an array. Sections without
+// keys of their own are left to the tables below them. With types, values
+// that read as TOML integers, floats or booleans are written without
+// quotes, so that port = 5432 is an integer; every other value is a
+// string.
+func tomlFromStatements(ss statements, w io.Writer, types bool) error {
+	globalKeys, sections, sectionOrder, emptyOnlySections := indexStatements(ss)
+	comments, sectionComments := indexComments(ss)
+	attrs, _ := indexAttributes(ss)
+	tw := &tomlWriter{
+		w:               w,
+		comments:        comments,
+		attrs:           attrs,
+		sectionComments: sectionComments,
+		tables:          make(map[string]bool),
+		types:           types,
+	}
+	for _, secName := range sectionOrder {
+		tw.tables[secName] = true
+	}
+
+	if err := tw.writeKeys("", globalKeys); err != nil {
+		return err
+	}
+	first := len(globalKeys) == 0
+
+	for _, secName := range sectionOrder {
+		kvs := sections[secName]
+		if len(kvs) == 0 && (!emptyOnlySections[secName] || hasSubsection(sectionOrder, secName)) {
+			continue
+		}
+		if !first {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		first = false
+		if err := writeHashComment(w, "#", tw.sectionComments[secName]); err != nil {
+			return err
+		}
+		parts := strings.Split(secName, ".")
+		if len(kvs) > 0 {
+			parts = kvs[0].path[:len(kvs[0].path)-1]
+		}
+		if _, err := fmt.Fprintf(w, "[%s]\n", tomlKeyPath(parts)); err != nil {
+			return err
+		}
+		if err := tw.writeKeys(secName, kvs); err != nil {
+			return err
+		}
+	}
+	return writeHashComment(w, "#", tw.sectionComments[""])
+}
+
+// writeKeys writes the keys of section, each preceded by its comments.
+func (tw *tomlWriter) writeKeys(section string, kvs []ungrinKVPair) error {
+	for i := 0; i < len(kvs); {
+		kv := kvs[i]
+		name := kv.key
+		if section != "" {
+			name = section + "." + name
+		}
+		if tw.tables[name] {
+			return fmt.Errorf("%s is both a value and a section, which TOML can't express", name)
+		}
+
+		// The occurrences of a repeated key are next to each other
+		n := 1
+		for kv.index >= 0 && i+n < len(kvs) && kvs[i+n].key == kv.key && kvs[i+n].index >= 0 {
+			n++
+		}
+		var values []string
+		for _, item := range kvs[i : i+n] {
+			if err := writeHashComment(tw.w, "#", tw.comments[item.commentKey()]); err != nil {
+				return err
+			}
+			values = append(values, tw.value(item))
+		}
+
+		value := values[0]
+		if kv.index >= 0 {
+			value = "[" + strings.Join(values, ", ") + "]"
+		}
+		line := tomlKey(kv.key) + " = " + value
+		if comment := tw.attrs[kvs[i+n-1].commentKey()]["comment"]; comment != "" {
+			line += " #" + strings.TrimLeft(comment, ";#")
+		}
+		if _, err := fmt.Fprintln(tw.w, line); err != nil {
+			return err
+		}
+		i += n
+	}
+	return nil
+}
+
+// value formats the value of kv for TOML: as a number or boolean if
+// --types gave it that type or if types is set and it reads as a TOML
+// integer, float or boolean, and as a string otherwise.
+func (tw *tomlWriter) value(kv ungrinKVPair) string {
+	switch {
+	case kv.typ == typBoolean:
+		b, _ := booleanValue(kv.value)
+		return strconv.FormatBool(b)
+	case (tw.types || kv.typ == typNumber) && isTOMLScalar(kv.value):
+		return kv.value
+	}
+	return tomlString(kv.value)
+}
+
+// isTOMLScalar reports whether value is a TOML boolean, a decimal integer
+// or a decimal float, written as TOML would write it back.
+func isTOMLScalar(value string) bool {
+	if value == "true" || value == "false" || isNumber(value) {
+		return true
+	}
+	// TOML numbers may also have a plus sign
+	rest, ok := strings.CutPrefix(value, "+")
+	return ok && !strings.HasPrefix(rest, "-") && isNumber(rest)
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStatementsFromTOML(t *testing.T) {
+	input := `# Application
+title = "Say \"hi\"\u00e9\t" # inline
+'literal key' = 'C:\path'
+hex = 0xff
+big = 1_000
+float = 6.626e-34
+when = 1979-05-27 07:32:00
+multi = """
+one \
+    two"""
+lines = '''
+a
+b'''
+
+[database.pool]
+size = 10
+hosts = [
+  "a", # first
+  "b",
+]
+tls.enabled = true
+
+[servers."alpha.example"]
+limits = { min = 5, max = { hard = 20 } }
+`
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromTOML(strings.NewReader(input), prefix, optComments)
+	if err != nil {
+		t.Fatalf("statementsFromTOML error: %v", err)
+	}
+
+	want := []string{
+		`ini = {};`,
+		`ini.title # "# Application";`,
+		`ini.title = "Say \"hi\"é\t";`,
+		`ini.title@comment = "# inline";`,
+		`ini["literal key"] = "C:\\path";`,
+		`ini.hex = "255";`,
+		`ini.big = "1000";`,
+		`ini.float = "6.626e-34";`,
+		`ini.when = "1979-05-27 07:32:00";`,
+		`ini.multi = "one two";`,
+		`ini.lines = "a\nb";`,
+		`ini.database = {};`,
+		`ini.database.pool = {};`,
+		`ini.database.pool.size = "10";`,
+		`ini.database.pool.hosts[0] = "a";`,
+		`ini.database.pool.hosts[1] = "b";`,
+		`ini.database.pool.tls = {};`,
+		`ini.database.pool.tls.enabled = "true";`,
+		`ini.servers = {};`,
+		`ini.servers["alpha.example"] = {};`,
+		`ini.servers["alpha.example"].limits = {};`,
+		`ini.servers["alpha.example"].limits.min = "5";`,
+		`ini.servers["alpha.example"].limits.max = {};`,
+		`ini.servers["alpha.example"].limits.max.hard = "20";`,
+	}
+
+	if len(ss) != len(want) {
+		for _, s := range ss {
+			t.Log(statementToString(s))
+		}
+		t.Fatalf("got %d statements, want %d", len(ss), len(want))
+	}
+	for i, s := range ss {
+		if got := statementToString(s); got != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestStatementsFromTOMLErrors(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{"array of tables", "[[products]]\nname = \"x\"\n"},
+		{"nested array", "a = [[1, 2]]\n"},
+		{"table in array", "a = [{ x = 1 }]\n"},
+		{"empty array", "a = []\n"},
+		{"key set twice", "a = 1\na = 2\n"},
+		{"table over a value", "a = 1\n[a]\n"},
+		{"dotted key over a value", "a = 1\na.b = 2\n"},
+		{"missing equals", "a 1\n"},
+		{"missing value", "a =\n"},
+		{"leading zero", "a = 0755\n"},
+		{"bare word value", "a = yes\n"},
+		{"text after value", "a = 1 2\n"},
+		{"unterminated string", "a = \"open\n"},
+		{"unterminated multi-line string", "a = '''open\n"},
+		{"invalid escape", "a = \"\\q\"\n"},
+		{"malformed unicode escape", "a = \"\\u12\"\n"},
+		{"unclosed table", "[a\n"},
+		{"unclosed inline table", "a = { b = 1\n"},
+	}
+
+	prefix := statement{{text: "ini", typ: typBare}}
+	for _, tt := range tests {
+		if _, err := statementsFromTOML(strings.NewReader(tt.input), prefix, 0); err == nil {
+			t.Errorf("%s: expected error, got nil", tt.desc)
+		}
+	}
+}
+
+func TestTOMLFromStatements(t *testing.T) {
+	input := `ini = {};
+ini # "; Application";
+ini.name = "My \"App\"";
+ini.port = "5432";
+ini.enabled = "true";
+ini.ratio = "0.5";
+ini.mode = "0755";
+ini.answer = "yes";
+ini["key with spaces"] = "v";
+ini.database = {};
+ini.database.pool = {};
+ini.database.pool # "; Connection pool";
+ini.database.pool.max = "20";
+ini.database.pool.max@comment = "; per host";
+ini.servers["alpha.example"].hosts[1] = "b";
+ini.servers["alpha.example"].hosts[0] = "a";
+ini.empty = {};
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	tests := []struct {
+		types bool
+		want  string
+	}{
+		{false, `name = "My \"App\""
+port = "5432"
+enabled = "true"
+ratio = "0.5"
+mode = "0755"
+answer = "yes"
+"key with spaces" = "v"
+
+# Connection pool
+[database.pool]
+max = "20" # per host
+
+[servers."alpha.example"]
+hosts = ["a", "b"]
+
+[empty]
+# Application
+`},
+		{true, `name = "My \"App\""
+port = 5432
+enabled = true
+ratio = 0.5
+mode = "0755"
+answer = "yes"
+"key with spaces" = "v"
+
+# Connection pool
+[database.pool]
+max = 20 # per host
+
+[servers."alpha.example"]
+hosts = ["a", "b"]
+
+[empty]
+# Application
+`},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := tomlFromStatements(ss, &buf, tt.types); err != nil {
+			t.Fatalf("tomlFromStatements error: %v", err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("toml output with types %v:\ngot:\n%s\nwant:\n%s", tt.types, buf.String(), tt.want)
+		}
+
+		// And back again
+		prefix := statement{{text: "ini", typ: typBare}}
+		again, err := statementsFromTOML(strings.NewReader(buf.String()), prefix, 0)
+		if err != nil {
+			t.Fatalf("statementsFromTOML error: %v", err)
+		}
+		values := assignmentValues(again)
+		for path, want := range assignmentValues(ss) {
+			if values[path].text != want.text {
+				t.Errorf("round trip %s = %s, want %s", path, values[path].text, want.text)
+			}
+		}
+	}
+}
+
+func TestTOMLFromStatementsConflict(t *testing.T) {
+	input := `ini.database = "x";
+ini.database.host = "y";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+	if err := tomlFromStatements(ss, &bytes.Buffer{}, false); err == nil {
+		t.Error("expected error for a key that is also a section, got nil")
+	}
+}
+
+func TestIsTOMLScalar(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"5432", true},
+		{"-17", true},
+		{"+3", true},
+		{"0", true},
+		{"0755", false},
+		{"99999999999999999999", false},
+		{"3.14", true},
+		{"-0.5", true},
+		{"1e6", true},
+		{"6.626e-34", true},
+		{"1.", false},
+		{".5", false},
+		{"1e", false},
+		{"true", true},
+		{"false", true},
+		{"True", false},
+		{"yes", false},
+		{"", false},
+		{"1_000", false},
+		{"0x1f", false},
+		{"12abc", false},
+	}
+
+	for _, tt := range tests {
+		if got := isTOMLScalar(tt.value); got != tt.want {
+			t.Errorf("isTOMLScalar(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseTOMLScalar(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"true", "true"},
+		{"42", "42"},
+		{"+42", "42"},
+		{"1_000", "1000"},
+		{"0xDEAD_BEEF", "3735928559"},
+		{"0o755", "493"},
+		{"0b1010", "10"},
+		{"3.1415", "3.1415"},
+		{"1e1_0", "1e10"},
+		{"-inf", "-inf"},
+		{"nan", "nan"},
+		{"1979-05-27", "1979-05-27"},
+		{"07:32:00.999", "07:32:00.999"},
+		{"1979-05-27T00:32:00-07:00", "1979-05-27T00:32:00-07:00"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTOMLScalar(tt.text, 1)
+		if err != nil {
+			t.Errorf("parseTOMLScalar(%q) error: %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseTOMLScalar(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTOMLKey(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{"host", "host"},
+		{"max-conns", "max-conns"},
+		{"1st", "1st"},
+		{"alpha.example", `"alpha.example"`},
+		{"with space", `"with space"`},
+		{"", `""`},
+		{"caf\u00e9", `"café"`},
+	}
+
+	for _, tt := range tests {
+		if got := tomlKey(tt.key); got != tt.want {
+			t.Errorf("tomlKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
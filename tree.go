@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// node is one level of the nested structure described by a set of grin
+// statements. Objects keep their keys in the order they were first seen so
+// that structured output formats can honor --no-sort.
+type node struct {
+	keys     []string
+	children map[string]*node
+	value    string
+	isLeaf   bool
+	// typ is the type of a leaf's value token, such as typNumber with
+	// --types.
+	typ tokenTyp
+	// items holds the leaves of a repeated key, by index.
+	items   map[int]*node
+	isArray bool
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node)}
+}
+
+// kind describes what n holds, for use in conflict errors.
+func (n *node) kind() string {
+	switch {
+	case n.isLeaf:
+		return "a value"
+	case n.isArray:
+		return "a list"
+	default:
+		return "an object"
+	}
+}
+
+// child returns the child stored under key, creating it with init if it
+// doesn't exist yet. It fails if the existing child is of a different kind.
+func (n *node) child(key string, init func() *node) (*node, error) {
+	want := init()
+	c, ok := n.children[key]
+	if !ok {
+		n.children[key] = want
+		n.keys = append(n.keys, key)
+		return want, nil
+	}
+	if c.kind() != want.kind() {
+		return nil, fmt.Errorf("%q already holds %s", key, c.kind())
+	}
+	return c, nil
+}
+
+// object returns the child object stored under key, creating it if needed.
+func (n *node) object(key string) (*node, error) {
+	return n.child(key, newNode)
+}
+
+// setValue stores a value of type typ under key, replacing any earlier
+// value.
+func (n *node) setValue(key, value string, typ tokenTyp) error {
+	c, err := n.child(key, func() *node { return &node{isLeaf: true} })
+	if err != nil {
+		return err
+	}
+	c.value, c.typ = value, typ
+	return nil
+}
+
+// setItem stores one occurrence of a repeated key.
+func (n *node) setItem(key string, index int, value string, typ tokenTyp) error {
+	c, err := n.child(key, func() *node { return &node{isArray: true, items: make(map[int]*node)} })
+	if err != nil {
+		return err
+	}
+	c.items[index] = &node{isLeaf: true, value: value, typ: typ}
+	return nil
+}
+
+// sortedItems returns the leaves of an array node in index order.
+func (n *node) sortedItems() []*node {
+	indexes := make([]int, 0, len(n.items))
+	for i := range n.items {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	values := make([]*node, len(indexes))
+	for i, idx := range indexes {
+		values[i] = n.items[idx]
+	}
+	return values
+}
+
+// treeFromStatements assembles statements into a nested tree, with every
+// path component below the root becoming an object key and repeated keys
+// becoming lists.
+func treeFromStatements(ss statements) (*node, error) {
+	root := newNode()
+
+	for _, s := range ss {
+		path, value, isObj := extractPathAndValue(s)
+		if len(path) == 0 {
+			continue
+		}
+
+		cur := root
+		for _, p := range path[:len(path)-1] {
+			next, err := cur.object(p)
+			if err != nil {
+				return nil, fmt.Errorf("conflicting assignments at %s: %w", strings.Join(path, "."), err)
+			}
+			cur = next
+		}
+
+		key := path[len(path)-1]
+		_, v, _ := splitAssignment(s)
+		var err error
+		switch index := statementIndex(s); {
+		case isObj:
+			_, err = cur.object(key)
+		case index >= 0:
+			err = cur.setItem(key, index, value, v.typ)
+		default:
+			err = cur.setValue(key, value, v.typ)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("conflicting assignments at %s: %w", strings.Join(path, "."), err)
+		}
+	}
+
+	return root, nil
+}
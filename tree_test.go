@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTreeFromStatements(t *testing.T) {
+	input := `ini = {};
+ini.name = "grin";
+ini.database = {};
+ini.database.host = "localhost";
+ini.database.pool = {};
+ini.database.pool.max = "10";
+ini.empty = {};
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	root, err := treeFromStatements(ss)
+	if err != nil {
+		t.Fatalf("treeFromStatements error: %v", err)
+	}
+
+	wantKeys := []string{"name", "database", "empty"}
+	if strings.Join(root.keys, ",") != strings.Join(wantKeys, ",") {
+		t.Errorf("root keys = %v, want %v", root.keys, wantKeys)
+	}
+	if n := root.children["name"]; !n.isLeaf || n.value != "grin" {
+		t.Errorf("name = %+v, want leaf \"grin\"", n)
+	}
+	pool := root.children["database"].children["pool"]
+	if pool == nil || pool.isLeaf {
+		t.Fatalf("database.pool = %+v, want object", pool)
+	}
+	if n := pool.children["max"]; !n.isLeaf || n.value != "10" {
+		t.Errorf("database.pool.max = %+v, want leaf \"10\"", n)
+	}
+	if n := root.children["empty"]; n.isLeaf || len(n.keys) != 0 {
+		t.Errorf("empty = %+v, want empty object", n)
+	}
+}
+
+func TestTreeFromStatementsConflict(t *testing.T) {
+	tests := []string{
+		"ini.a = \"1\";\nini.a.b = \"2\";\n",
+		"ini.a.b = \"2\";\nini.a = \"1\";\n",
+		"ini.a = \"1\";\nini.a = {};\n",
+		"ini.a = \"1\";\nini.a[0] = \"2\";\n",
+		"ini.a[0] = \"1\";\nini.a.b = \"2\";\n",
+	}
+
+	for _, input := range tests {
+		ss, err := ungrinStatements(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("ungrinStatements error: %v", err)
+		}
+		if _, err := treeFromStatements(ss); err == nil {
+			t.Errorf("treeFromStatements(%q): expected error, got nil", input)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -13,6 +15,58 @@ import (
 type ungrinKVPair struct {
 	key   string
 	value string
+	// index is the occurrence number of a repeated key, or -1.
+	index int
+	// path holds the components of the key's path below the root.
+	path []string
+	// typ is the type of the value's token, such as typNumber with
+	// --types.
+	typ tokenTyp
+}
+
+// commentKey returns the key under which indexComments and
+// indexAttributes store what is attached to kv.
+func (kv ungrinKVPair) commentKey() string {
+	return indexedPath(kv.path, kv.index)
+}
+
+// indexedPath returns the keyPath of path followed by its index segment,
+// if index is not -1.
+func indexedPath(path []string, index int) string {
+	key := keyPath(path)
+	if index >= 0 {
+		key += "[" + strconv.Itoa(index) + "]"
+	}
+	return key
+}
+
+// keyPath renders the path of a key as grin writes it below the root, so
+// that a key named "b.c" in section a, a["b.c"], is told apart from key c
+// in section a.b.
+func keyPath(path []string) string {
+	var b strings.Builder
+	for i, p := range path {
+		switch {
+		case !validIdentifier(p):
+			b.WriteString("[" + quoteString(p) + "]")
+		case i > 0:
+			b.WriteString("." + p)
+		default:
+			b.WriteString(p)
+		}
+	}
+	return b.String()
+}
+
+// valuedPaths returns the indexedPath of every key that ss assigns a value.
+func valuedPaths(ss statements) map[string]bool {
+	valued := make(map[string]bool)
+	for _, s := range ss {
+		if path, _, isObj := extractPathAndValue(s); path != nil && !isObj {
+			valued[indexedPath(path, statementIndex(s))] = true
+		}
+	}
+	return valued
 }
 
 // ungrinStatements reads grin assignment lines from r and returns them as
@@ -45,13 +99,19 @@ func ungrinStatements(r io.Reader) (statements, error) {
 }
 
 // ungrinFromStatements converts parsed grin statements back into INI format.
+// Comment statements are written above the key or section they describe,
+// and multi-line values are continued in the style their attributes name.
 func ungrinFromStatements(ss statements, w io.Writer) error {
 	globalKeys, sections, sectionOrder, emptyOnlySections := indexStatements(ss)
+	comments, sectionComments := indexComments(ss)
+	attrs, _ := indexAttributes(ss)
 
 	first := true
-
 	for _, kv := range globalKeys {
-		if _, err := fmt.Fprintf(w, "%s = %s\n", kv.key, kv.value); err != nil {
+		if err := writeComment(w, comments[kv.commentKey()]); err != nil {
+			return err
+		}
+		if err := writeKeyValue(w, kv, attrs[kv.commentKey()]); err != nil {
 			return err
 		}
 		first = false
@@ -68,17 +128,23 @@ func ungrinFromStatements(ss statements, w io.Writer) error {
 			}
 		}
 		first = false
+		if err := writeComment(w, sectionComments[secName]); err != nil {
+			return err
+		}
 		if _, err := fmt.Fprintf(w, "[%s]\n", secName); err != nil {
 			return err
 		}
 		for _, kv := range kvs {
-			if _, err := fmt.Fprintf(w, "%s = %s\n", kv.key, kv.value); err != nil {
+			if err := writeComment(w, comments[kv.commentKey()]); err != nil {
+				return err
+			}
+			if err := writeKeyValue(w, kv, attrs[kv.commentKey()]); err != nil {
 				return err
 			}
 		}
 	}
 
-	return nil
+	return writeComment(w, sectionComments[""])
 }
 
 // indexStatements processes parsed statements and returns the data structures
@@ -111,22 +177,76 @@ func indexStatements(ss statements) (
 			continue
 		}
 
+		_, v, _ := splitAssignment(s)
+		kv := ungrinKVPair{key: path[len(path)-1], value: value, index: statementIndex(s), path: path, typ: v.typ}
 		if len(path) == 1 {
-			globalKeys = append(globalKeys, ungrinKVPair{key: path[0], value: value})
+			globalKeys = append(globalKeys, kv)
 		} else {
 			secName := strings.Join(path[:len(path)-1], ".")
-			key := path[len(path)-1]
 			if !seenSections[secName] {
 				seenSections[secName] = true
 				sectionOrder = append(sectionOrder, secName)
 			}
 			delete(emptyOnlySections, secName)
-			sections[secName] = append(sections[secName], ungrinKVPair{key: key, value: value})
+			sections[secName] = append(sections[secName], kv)
 		}
 	}
+
+	globalKeys = orderIndexed(globalKeys)
+	for secName, kvs := range sections {
+		sections[secName] = orderIndexed(kvs)
+	}
 	return
 }
 
+// orderIndexed puts the occurrences of each repeated key in index order at
+// the position of the first one seen, leaving other keys where they are.
+func orderIndexed(kvs []ungrinKVPair) []ungrinKVPair {
+	groups := make(map[string][]ungrinKVPair)
+	for _, kv := range kvs {
+		if kv.index >= 0 {
+			groups[kv.key] = append(groups[kv.key], kv)
+		}
+	}
+	if len(groups) == 0 {
+		return kvs
+	}
+
+	ordered := make([]ungrinKVPair, 0, len(kvs))
+	for _, kv := range kvs {
+		if kv.index < 0 {
+			ordered = append(ordered, kv)
+			continue
+		}
+		group, ok := groups[kv.key]
+		if !ok {
+			// already placed with the first occurrence
+			continue
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].index < group[j].index
+		})
+		ordered = append(ordered, group...)
+		delete(groups, kv.key)
+	}
+	return ordered
+}
+
+// statementIndex returns the index segment of a repeated key's statement,
+// such as the 1 in `ini.php.extension[1] = "gd";`, or -1 if there is none.
+func statementIndex(s statement) int {
+	for _, t := range s {
+		if t.typ == typNumericKey {
+			n, err := strconv.Atoi(t.text)
+			if err != nil {
+				return -1
+			}
+			return n
+		}
+	}
+	return -1
+}
+
 // extractPathAndValue extracts the path components and value from a statement.
 // Returns (path, value, isObject). path is nil if the statement should be skipped.
 func extractPathAndValue(s statement) (path []string, value string, isObj bool) {
@@ -142,9 +262,13 @@ func extractPathAndValue(s statement) (path []string, value string, isObj bool)
 			if !foundEquals {
 				parts = append(parts, t.text)
 			}
+		case typQuotedKey:
+			if !foundEquals {
+				parts = append(parts, unquoteString(t.text))
+			}
 		case typEquals:
 			foundEquals = true
-		case typString:
+		case typString, typNumber, typBoolean:
 			if foundEquals {
 				val = unquoteString(t.text)
 			}
@@ -152,8 +276,11 @@ func extractPathAndValue(s statement) (path []string, value string, isObj bool)
 			if foundEquals {
 				isObject = true
 			}
-		case typDot, typSemi, typIgnored:
-			// skip punctuation
+		case typHash, typAt:
+			// comment and attribute statements carry no value
+			return nil, "", false
+		case typDot, typLBrace, typNumericKey, typRBrace, typSemi, typPosition, typIgnored:
+			// skip punctuation and indexes
 		}
 	}
 
@@ -169,6 +296,225 @@ func extractPathAndValue(s statement) (path []string, value string, isObj bool)
 	return parts, val, isObject
 }
 
+// commentFromStatement extracts the path and text of a comment statement
+// such as `ini.section.key # "; note";`. ok is false for other statements.
+func commentFromStatement(s statement) (path []string, text string, ok bool) {
+	for _, t := range s {
+		switch t.typ {
+		case typBare:
+			if !ok {
+				path = append(path, t.text)
+			}
+		case typQuotedKey:
+			if !ok {
+				path = append(path, unquoteString(t.text))
+			}
+		case typHash:
+			ok = true
+		case typComment:
+			text = unquoteString(t.text)
+		}
+	}
+
+	if !ok {
+		return nil, "", false
+	}
+	if len(path) > 0 && path[0] == "ini" {
+		path = path[1:]
+	}
+	return path, text, true
+}
+
+// indexComments maps the paths of keys, as given by commentKey, and the
+// dotted names of sections to the comment text attached to them, so that a
+// key and a section at the same path keep their own comments. A comment
+// belongs to the next assignment to its path, as the readers write it; if
+// there is none it belongs to the section unless its path has a value. The
+// root comment is stored under the empty section name.
+func indexComments(ss statements) (keys, sections map[string]string) {
+	keys = make(map[string]string)
+	sections = make(map[string]string)
+	valued := valuedPaths(ss)
+	// next records whether the next assignment to a path declares a section
+	next := make(map[string]bool)
+	for i := len(ss) - 1; i >= 0; i-- {
+		s := ss[i]
+		path, text, ok := commentFromStatement(s)
+		if !ok {
+			if path, _, isObj := extractPathAndValue(s); path != nil {
+				next[indexedPath(path, statementIndex(s))] = isObj
+			}
+			continue
+		}
+		id := indexedPath(path, statementIndex(s))
+		isSection, found := next[id]
+		if !found {
+			isSection = !valued[id]
+		}
+		if isSection {
+			name := strings.Join(path, ".")
+			sections[name] = joinComments(text, sections[name])
+		} else {
+			keys[id] = joinComments(text, keys[id])
+		}
+	}
+	return keys, sections
+}
+
+// attributeFromStatement extracts the key path, attribute name and value
+// from an attribute statement such as `ini.a.key@continuation = "indent";`.
+// ok is false if s is not an attribute statement.
+func attributeFromStatement(s statement) (path []string, name, value string, ok bool) {
+	for _, t := range s {
+		switch t.typ {
+		case typBare:
+			path = append(path, t.text)
+		case typQuotedKey:
+			path = append(path, unquoteString(t.text))
+		case typAttribute:
+			name, ok = t.text, true
+		case typString:
+			value = unquoteString(t.text)
+		}
+	}
+
+	if !ok {
+		return nil, "", "", false
+	}
+	if len(path) > 0 && path[0] == "ini" {
+		path = path[1:]
+	}
+	return path, name, value, true
+}
+
+// indexAttributes collects the attributes of each key, stored under the
+// same keys as indexComments, and of each section, stored under its dotted
+// name. An attribute belongs to the key at its path if there is one.
+func indexAttributes(ss statements) (keys, sections map[string]map[string]string) {
+	keys = make(map[string]map[string]string)
+	sections = make(map[string]map[string]string)
+	valued := valuedPaths(ss)
+	for _, s := range ss {
+		path, name, value, ok := attributeFromStatement(s)
+		if !ok {
+			continue
+		}
+		attrs, id := keys, indexedPath(path, statementIndex(s))
+		if !valued[id] {
+			attrs, id = sections, strings.Join(path, ".")
+		}
+		if attrs[id] == nil {
+			attrs[id] = make(map[string]string)
+		}
+		attrs[id][name] = value
+	}
+	return keys, sections
+}
+
+// withoutAttribute returns ss without the statements that set the
+// attribute name, so that keys are written in the default way.
+func withoutAttribute(ss statements, name string) statements {
+	kept := make(statements, 0, len(ss))
+	for _, s := range ss {
+		if _, attr, _, ok := attributeFromStatement(s); ok && attr == name {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// writeKeyValue writes a key line with the delimiter recorded in its
+// attributes, continuing a multi-line value in the style they name and
+// followed by its inline comment.
+func writeKeyValue(w io.Writer, kv ungrinKVPair, attrs map[string]string) error {
+	if err := checkINIKey(kv.key); err != nil {
+		return err
+	}
+	first, rest := continuationLines(kv.value, attrs["continuation"])
+	sep := " = "
+	if attrs["delimiter"] == ":" {
+		sep = ": "
+	}
+	line := kv.key + sep + first
+	if first == "" && len(rest) > 0 {
+		// The value starts on the next line
+		line = kv.key + strings.TrimRight(sep, " ")
+	}
+	if comment := attrs["comment"]; comment != "" {
+		line = addInlineComment(line, comment)
+	}
+	if _, err := fmt.Fprintln(w, line); err != nil {
+		return err
+	}
+	for _, line := range rest {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addInlineComment appends comment to a key line, before the backslash
+// that continues its value if there is one. A value that would itself be
+// read as starting a comment is quoted.
+func addInlineComment(line, comment string) string {
+	eqIdx := delimiterIndex(line)
+	value, more := trimContinuation(strings.TrimSpace(line[eqIdx+1:]))
+	if _, c := splitInlineComment(" " + value); c != "" {
+		value = `"` + value + `"`
+	}
+
+	text := line[:eqIdx+1]
+	if value != "" {
+		text += " " + value
+	}
+	text += " " + comment
+	if more {
+		text += " \\"
+	}
+	return text
+}
+
+// writeComment writes each line of a comment block, adding a "; " marker to
+// lines that don't already start with one.
+func writeComment(w io.Writer, text string) error {
+	if text == "" {
+		return nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" || (line[0] != ';' && line[0] != '#') {
+			line = "; " + line
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHashComment writes each line of a comment block for a format whose
+// comments start with one of markers, the first of which is '#'. A line
+// that starts with an INI comment's ';' has it replaced by '#', and other
+// lines are marked with "# ".
+func writeHashComment(w io.Writer, markers, text string) error {
+	if text == "" {
+		return nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.HasPrefix(line, ";"):
+			line = "#" + line[1:]
+		case line == "" || !strings.ContainsRune(markers, rune(line[0])):
+			line = "# " + line
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Lexer for parsing grin assignment lines back into tokens.
 
 type lexer struct {
@@ -221,15 +567,89 @@ func (l *lexer) skipWhitespace() {
 func lexStatement(line string) (statement, error) {
 	l := newLexer(line)
 
-	// Parse: Path = Value ;
-	// Path: BareWord ( "." BareWord )*
-	// Value: String | "{}"
+	// Parse: Path [@Attribute] = Value ; [Position]  or  Path # Comment ;
+	// Path: BareWord ( "." BareWord | "[" Number "]" | "[" String "]" )*
+	// Value: String | Number | Boolean | "{}"
+	// Comment: String
+	// Position: "//" Text
+
+	if err := l.lexPath(); err != nil {
+		return nil, err
+	}
+
+	// Attribute of the key
+	l.skipWhitespace()
+	if l.peek() == '@' {
+		l.next()
+		l.emit(typAt, "@")
+		l.skipWhitespace()
+		if err := l.lexAttribute(); err != nil {
+			return nil, fmt.Errorf("parsing attribute: %w", err)
+		}
+		l.skipWhitespace()
+		if l.peek() != '=' {
+			return nil, fmt.Errorf("expected '=' after attribute, got %q", string(l.peek()))
+		}
+	}
+
+	// Equals and value, or hash and comment
+	r := l.next()
+	switch r {
+	case '=':
+		l.emit(typEquals, " = ")
+		l.skipWhitespace()
+		if err := l.lexValue(); err != nil {
+			return nil, fmt.Errorf("parsing value: %w", err)
+		}
+	case '#':
+		l.emit(typHash, " # ")
+		l.skipWhitespace()
+		if err := l.lexString(typComment); err != nil {
+			return nil, fmt.Errorf("parsing comment: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("expected '=' or '#', got %q", string(r))
+	}
+
+	// Semicolon
+	l.skipWhitespace()
+	r = l.next()
+	if r != ';' {
+		return nil, fmt.Errorf("expected ';', got %q", string(r))
+	}
+	l.emit(typSemi, ";")
+
+	// Optional source position
+	l.skipWhitespace()
+	if rest := l.input[l.pos:]; strings.HasPrefix(rest, "//") {
+		l.emit(typPosition, " // "+strings.TrimSpace(rest[2:]))
+	}
+
+	return statement(l.tokens), nil
+}
+
+// lexPath parses a grin path such as `ini.database["my key"]` on its own,
+// as given on the command line.
+func lexPath(input string) (statement, error) {
+	l := newLexer(input)
+	if err := l.lexPath(); err != nil {
+		return nil, err
+	}
+	l.skipWhitespace()
+	if r := l.next(); r != -1 {
+		return nil, fmt.Errorf("parsing path: unexpected %q", string(r))
+	}
+	return statement(l.tokens), nil
+}
 
+// lexPath lexes a path: a bare word followed by dotted or bracketed
+// components.
+func (l *lexer) lexPath() error {
 	l.skipWhitespace()
 
 	// First bare word
 	if err := l.lexBareWord(); err != nil {
-		return nil, fmt.Errorf("parsing statement: %w", err)
+		return fmt.Errorf("parsing statement: %w", err)
 	}
 
 	// More path components
@@ -241,36 +661,25 @@ func lexStatement(line string) (statement, error) {
 			l.emit(typDot, ".")
 			l.skipWhitespace()
 			if err := l.lexBareWord(); err != nil {
-				return nil, fmt.Errorf("parsing path: %w", err)
+				return fmt.Errorf("parsing path: %w", err)
+			}
+		} else if r == '[' {
+			if err := l.lexBracket(); err != nil {
+				return fmt.Errorf("parsing path: %w", err)
 			}
 		} else {
-			break
+			return nil
 		}
 	}
+}
 
-	// Equals
-	l.skipWhitespace()
-	r := l.next()
-	if r != '=' {
-		return nil, fmt.Errorf("expected '=', got %q", string(r))
-	}
-	l.emit(typEquals, " = ")
-
-	// Value
-	l.skipWhitespace()
-	if err := l.lexValue(); err != nil {
-		return nil, fmt.Errorf("parsing value: %w", err)
-	}
-
-	// Semicolon
-	l.skipWhitespace()
-	r = l.next()
-	if r != ';' {
-		return nil, fmt.Errorf("expected ';', got %q", string(r))
+// lexAttribute lexes the name of a key attribute, after its "@".
+func (l *lexer) lexAttribute() error {
+	if err := l.lexBareWord(); err != nil {
+		return err
 	}
-	l.emit(typSemi, ";")
-
-	return statement(l.tokens), nil
+	l.tokens[len(l.tokens)-1].typ = typAttribute
+	return nil
 }
 
 func (l *lexer) lexBareWord() error {
@@ -292,20 +701,83 @@ func (l *lexer) lexBareWord() error {
 	return nil
 }
 
+// lexBracket lexes a bracketed path component: an index such as "[0]" or a
+// quoted key such as ["my key"].
+func (l *lexer) lexBracket() error {
+	l.next() // consume [
+	l.emit(typLBrace, "[")
+	l.skipWhitespace()
+
+	if l.peek() == '"' {
+		if err := l.lexString(typQuotedKey); err != nil {
+			return err
+		}
+	} else if err := l.lexNumber(); err != nil {
+		return err
+	}
+
+	l.skipWhitespace()
+	if r := l.next(); r != ']' {
+		return fmt.Errorf("expected ']', got %q", string(r))
+	}
+	l.emit(typRBrace, "]")
+	return nil
+}
+
+// lexNumber lexes the digits of an index segment.
+func (l *lexer) lexNumber() error {
+	start := l.pos
+	for {
+		r := l.next()
+		if r < '0' || r > '9' {
+			l.backup()
+			break
+		}
+	}
+	if l.pos == start {
+		return fmt.Errorf("expected index or quoted key, got %q", string(l.peek()))
+	}
+	l.emit(typNumericKey, l.input[start:l.pos])
+	return nil
+}
+
 func (l *lexer) lexValue() error {
 	r := l.peek()
 
-	switch r {
-	case '"':
-		return l.lexString()
-	case '{':
+	switch {
+	case r == '"':
+		return l.lexString(typString)
+	case r == '{':
 		return l.lexBraces()
+	case r == '-' || r >= '0' && r <= '9':
+		return l.lexLiteral(typNumber, isNumberSyntax)
+	case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+		return l.lexLiteral(typBoolean, func(s string) bool {
+			_, ok := booleanValue(s)
+			return ok
+		})
 	default:
 		return fmt.Errorf("expected value, got %q", string(r))
 	}
 }
 
-func (l *lexer) lexString() error {
+// lexLiteral lexes an unquoted number or boolean value, which runs up to
+// the next space or semicolon, and emits it with typ if valid accepts it.
+func (l *lexer) lexLiteral(typ tokenTyp, valid func(string) bool) error {
+	start := l.pos
+	for r := l.next(); r != -1 && r != ';' && !unicode.IsSpace(r); r = l.next() {
+	}
+	l.backup()
+	text := l.input[start:l.pos]
+	if !valid(text) {
+		return fmt.Errorf("expected value, got %q", text)
+	}
+	l.emit(typ, text)
+	return nil
+}
+
+// lexString lexes a double-quoted string and emits it with the given type.
+func (l *lexer) lexString(typ tokenTyp) error {
 	start := l.pos
 	r := l.next() // consume opening "
 	if r != '"' {
@@ -327,7 +799,7 @@ func (l *lexer) lexString() error {
 		}
 	}
 
-	l.emit(typString, l.input[start:l.pos])
+	l.emit(typ, l.input[start:l.pos])
 	return nil
 }
 
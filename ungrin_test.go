@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -18,6 +20,21 @@ func TestLexStatement(t *testing.T) {
 		{`ini.key = "";`, `ini.key = "";`},
 		{`ini.a.b.c = "deep";`, `ini.a.b.c = "deep";`},
 		{`ini.my-key = "value";`, `ini.my-key = "value";`},
+		{`ini.section.key # "; a comment";`, `ini.section.key # "; a comment";`},
+		{`ini  #  "; spaced";`, `ini # "; spaced";`},
+		{`ini.php.extension[0] = "gd";`, `ini.php.extension[0] = "gd";`},
+		{`ini.php.extension[ 12 ] = "gd";`, `ini.php.extension[12] = "gd";`},
+		{`ini["my section"]["my key"] = "v";`, `ini["my section"]["my key"] = "v";`},
+		{`ini["with \"quote\""].key = "v";`, `ini["with \"quote\""].key = "v";`},
+		{`ini.db.port = "5432"; // app.ini:42`, `ini.db.port = "5432"; // app.ini:42`},
+		{`ini.db = {};   //app.ini:3  `, `ini.db = {}; // app.ini:3`},
+		{`ini.a.path@continuation = "backslash";`, `ini.a.path@continuation = "backslash";`},
+		{`ini.a.path @ continuation = "indent";`, `ini.a.path@continuation = "indent";`},
+		{`ini.db.port = 5432;`, `ini.db.port = 5432;`},
+		{`ini.db.ratio = -1.5e3; // app.ini:3`, `ini.db.ratio = -1.5e3; // app.ini:3`},
+		{`ini.debug=yes;`, `ini.debug = yes;`},
+		{`ini.debug = On;`, `ini.debug = On;`},
+		{`ini.debug = off ;`, `ini.debug = off;`},
 	}
 
 	for _, tt := range tests {
@@ -44,6 +61,16 @@ func TestLexStatementErrors(t *testing.T) {
 		{`ini = "no semi"`, "missing semicolon"},
 		{`ini = unterminated`, "invalid value"},
 		{`ini = "unterminated;`, "unterminated string"},
+		{`ini.key # ;`, "comment without string"},
+		{`ini.key # {};`, "comment with object"},
+		{`ini.key[] = "v";`, "empty index"},
+		{`ini.key[a] = "v";`, "non-numeric index"},
+		{`ini.key[0 = "v";`, "unclosed index"},
+		{`ini["unterminated] = "v";`, "unterminated quoted key"},
+		{`ini["key" = "v";`, "unclosed quoted key"},
+		{`ini.port = 01;`, "leading zero"},
+		{`ini.port = 5432x;`, "trailing garbage after number"},
+		{`ini.debug = maybe;`, "unknown boolean"},
 	}
 
 	for _, tt := range tests {
@@ -66,6 +93,7 @@ func TestExtractPathAndValue(t *testing.T) {
 		{`ini.key = "val";`, []string{"key"}, "val", false},        // global key
 		{`ini.s.key = "val";`, []string{"s", "key"}, "val", false}, // section key
 		{`ini.a.b.c = "d";`, []string{"a", "b", "c"}, "d", false},  // deep path
+		{`ini["a b"]["c.d"] = "e";`, []string{"a b", "c.d"}, "e", false},
 	}
 
 	for _, tt := range tests {
@@ -277,3 +305,390 @@ ini.section.key = "value with \"quotes\"";
 		t.Errorf("ungrin output = %q, want %q", buf.String(), want)
 	}
 }
+
+func TestExtractPathAndValueSkipsComments(t *testing.T) {
+	s, err := lexStatement(`ini.section.key # "; note";`)
+	if err != nil {
+		t.Fatalf("lexStatement error: %v", err)
+	}
+	if path, _, _ := extractPathAndValue(s); path != nil {
+		t.Errorf("extractPathAndValue(comment): path = %v, want nil", path)
+	}
+
+	path, text, ok := commentFromStatement(s)
+	if !ok {
+		t.Fatal("commentFromStatement: ok = false, want true")
+	}
+	if strings.Join(path, ".") != "section.key" {
+		t.Errorf("commentFromStatement: path = %v, want [section key]", path)
+	}
+	if text != "; note" {
+		t.Errorf("commentFromStatement: text = %q, want %q", text, "; note")
+	}
+}
+
+func TestUngrinComments(t *testing.T) {
+	input := `ini # "; Trailing comment";
+ini = {};
+ini.app # "; Global key";
+ini.app = "myapp";
+ini.database # "; Database settings\n# two lines";
+ini.database = {};
+ini.database.host # "no marker";
+ini.database.host = "localhost";
+ini.database.port = "5432";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ungrinFromStatements(ss, &buf); err != nil {
+		t.Fatalf("ungrinFromStatements error: %v", err)
+	}
+
+	want := `; Global key
+app = myapp
+
+; Database settings
+# two lines
+[database]
+; no marker
+host = localhost
+port = 5432
+; Trailing comment
+`
+	if buf.String() != want {
+		t.Errorf("ungrin output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestUngrinTrailingComment(t *testing.T) {
+	input := "; header\nname = app\n\n[database]\nhost = localhost\n; tail\n"
+	prefix := statement{{text: "ini", typ: typBare}}
+	ss, err := statementsFromINI(strings.NewReader(input), prefix, optComments)
+	if err != nil {
+		t.Fatalf("statementsFromINI error: %v", err)
+	}
+
+	for _, sorted := range []bool{false, true} {
+		if sorted {
+			sort.Sort(ss)
+		}
+		var buf bytes.Buffer
+		if err := ungrinFromStatements(ss, &buf); err != nil {
+			t.Fatalf("ungrinFromStatements error: %v", err)
+		}
+		if buf.String() != input {
+			t.Errorf("round trip (sorted %v) = %q, want %q", sorted, buf.String(), input)
+		}
+	}
+}
+
+func TestUngrinDuplicateKeys(t *testing.T) {
+	// Indexes are reassembled in order even if the stream is shuffled
+	input := `ini.php.extension[2] = "mbstring";
+ini.php.memory_limit = "128M";
+ini.php.extension[0] = "curl";
+ini.php.extension[1] # "; graphics";
+ini.php.extension[1] = "gd";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ungrinFromStatements(ss, &buf); err != nil {
+		t.Fatalf("ungrinFromStatements error: %v", err)
+	}
+
+	want := "[php]\nextension = curl\n; graphics\nextension = gd\nextension = mbstring\nmemory_limit = 128M\n"
+	if buf.String() != want {
+		t.Errorf("ungrin output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestStatementIndex(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{`ini.key = "v";`, -1},
+		{`ini.key[0] = "v";`, 0},
+		{`ini.s.key[11] = "v";`, 11},
+	}
+
+	for _, tt := range tests {
+		s, err := lexStatement(tt.input)
+		if err != nil {
+			t.Fatalf("lexStatement(%q) error: %v", tt.input, err)
+		}
+		if got := statementIndex(s); got != tt.want {
+			t.Errorf("statementIndex(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestUngrinQuotedKeys(t *testing.T) {
+	input := `ini["2fa_enabled"] = "1";
+ini["http://example.com"] = {};
+ini["http://example.com"]["my key"] = "value";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ungrinFromStatements(ss, &buf); err != nil {
+		t.Fatalf("ungrinFromStatements error: %v", err)
+	}
+
+	want := "2fa_enabled = 1\n\n[http://example.com]\nmy key = value\n"
+	if buf.String() != want {
+		t.Errorf("ungrin output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestUngrinDottedKeysRoundTrip(t *testing.T) {
+	// A key named k.j in [s] must not take the comments of j in [s.k]
+	tests := []string{
+		"[s]\n; about k.j\nk.j = 3 ; inline\n\n[s.k]\n; about j\nj = 4\n",
+		"; about a.b\na.b = 1\n\n[a]\n; about b\nb = 2\n",
+		"[http://example.com]\n; about the key\nwww.example.com = 1 # inline\n",
+		"[s]\nk.j = 1\nk.j = 2 ; second\n\n[s.k]\nj = 3 ; inline\n",
+	}
+
+	prefix := statement{{text: "ini", typ: typBare}}
+	for _, input := range tests {
+		ss, err := statementsFromINI(strings.NewReader(input), prefix, optComments|optInlineComments)
+		if err != nil {
+			t.Fatalf("statementsFromINI(%q) error: %v", input, err)
+		}
+
+		// Through text, as a pipeline would see it
+		var grin bytes.Buffer
+		if err := writeGrin(ss, &grin, optMonochrome); err != nil {
+			t.Fatalf("writeGrin error: %v", err)
+		}
+		ss, err = ungrinStatements(&grin)
+		if err != nil {
+			t.Fatalf("ungrinStatements error: %v", err)
+		}
+
+		var buf bytes.Buffer
+		if err := ungrinFromStatements(ss, &buf); err != nil {
+			t.Fatalf("ungrinFromStatements error: %v", err)
+		}
+		if buf.String() != input {
+			t.Errorf("round trip of %q = %q", input, buf.String())
+		}
+	}
+}
+
+func TestUngrinKeyWithDelimiter(t *testing.T) {
+	for _, input := range []string{`ini["a=b"] = "1";`, `ini.s["a:b"] = "1";`} {
+		ss, err := ungrinStatements(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("ungrinStatements error: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := ungrinFromStatements(ss, &buf); err == nil {
+			t.Errorf("ungrinFromStatements(%q): expected error, got %q", input, buf.String())
+		}
+	}
+}
+
+func TestIndexComments(t *testing.T) {
+	ss, err := ungrinStatements(strings.NewReader(`ini = {};
+ini.s = {};
+ini.s.k # "; key";
+ini.s.k = "1";
+ini.s.k # "; section";
+ini.s.k = {};
+ini.s.k.j = "2";
+ini.s["k.j"] # "; dotted";
+ini.s["k.j"] = "3";
+ini.s["k.j"]@comment = "; inline";
+ini.s.list[1] # "; second";
+ini.s.list[1] = "b";
+ini # "; end";
+`))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	keys, sections := indexComments(ss)
+	wantKeys := map[string]string{"s.k": "; key", `s["k.j"]`: "; dotted", "s.list[1]": "; second"}
+	wantSections := map[string]string{"s.k": "; section", "": "; end"}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("key comments = %q, want %q", keys, wantKeys)
+	}
+	if !reflect.DeepEqual(sections, wantSections) {
+		t.Errorf("section comments = %q, want %q", sections, wantSections)
+	}
+
+	attrs, _ := indexAttributes(ss)
+	if got := attrs[`s["k.j"]`]["comment"]; got != "; inline" {
+		t.Errorf(`attribute of s["k.j"] = %q, want "; inline"`, got)
+	}
+}
+
+func TestUngrinIgnoresPositions(t *testing.T) {
+	input := `ini = {};
+ini.database = {}; // app.ini:4
+ini.database.host = "localhost"; // app.ini:5
+ini.name = "app"; // app.ini:1
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ungrinFromStatements(ss, &buf); err != nil {
+		t.Fatalf("ungrinFromStatements error: %v", err)
+	}
+
+	want := "name = app\n\n[database]\nhost = localhost\n"
+	if buf.String() != want {
+		t.Errorf("ungrin output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestUngrinTypedValues(t *testing.T) {
+	input := `ini = {};
+ini.database = {};
+ini.database.port = 5432;
+ini.database.ratio = 0.5;
+ini.database.debug = yes;
+ini.database.verbose = On;
+ini.database.host = "localhost";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ungrinFromStatements(ss, &buf); err != nil {
+		t.Fatalf("ungrinFromStatements error: %v", err)
+	}
+
+	want := "[database]\nport = 5432\nratio = 0.5\ndebug = yes\nverbose = On\nhost = localhost\n"
+	if buf.String() != want {
+		t.Errorf("ungrin output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestUngrinContinuations(t *testing.T) {
+	input := `ini = {};
+ini.options = {};
+ini.options.install_requires = "\nrequests>=2\nclick";
+ini.paths = {};
+ini.paths.search = "/usr/lib\n/usr/local/lib";
+ini.paths.search@continuation = "backslash";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ungrinFromStatements(ss, &buf); err != nil {
+		t.Fatalf("ungrinFromStatements error: %v", err)
+	}
+
+	want := "[options]\ninstall_requires =\n    requests>=2\n    click\n\n[paths]\nsearch = /usr/lib \\\n    /usr/local/lib\n"
+	if buf.String() != want {
+		t.Errorf("ungrin output = %q, want %q", buf.String(), want)
+	}
+
+	// And back again
+	prefix := statement{{text: "ini", typ: typBare}}
+	again, err := statementsFromINI(strings.NewReader(buf.String()), prefix, optBackslashContinuations)
+	if err != nil {
+		t.Fatalf("statementsFromINI error: %v", err)
+	}
+	for i, s := range again {
+		if got := statementToString(s); got != statementToString(ss[i]) {
+			t.Errorf("round trip statement %d: got %q, want %q", i, got, statementToString(ss[i]))
+		}
+	}
+}
+
+func TestUngrinInlineComments(t *testing.T) {
+	input := `ini = {};
+ini.mysqld = {};
+ini.mysqld.port = "5432";
+ini.mysqld.port@comment = "; default";
+ini.mysqld.name = "a ; b";
+ini.mysqld.name@comment = "# quoted";
+ini.mysqld.empty = "";
+ini.mysqld.empty@comment = "; nothing";
+ini.mysqld.path = "/a\n/b";
+ini.mysqld.path@continuation = "backslash";
+ini.mysqld.path@comment = "; paths";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ungrinFromStatements(ss, &buf); err != nil {
+		t.Fatalf("ungrinFromStatements error: %v", err)
+	}
+
+	want := "[mysqld]\nport = 5432 ; default\nname = \"a ; b\" # quoted\nempty = ; nothing\npath = /a ; paths \\\n    /b\n"
+	if buf.String() != want {
+		t.Errorf("ungrin output = %q, want %q", buf.String(), want)
+	}
+
+	// And back again
+	prefix := statement{{text: "ini", typ: typBare}}
+	again, err := statementsFromINI(strings.NewReader(buf.String()), prefix, optInlineComments|optComments|optBackslashContinuations)
+	if err != nil {
+		t.Fatalf("statementsFromINI error: %v", err)
+	}
+	for i, s := range again {
+		if got := statementToString(s); got != statementToString(ss[i]) {
+			t.Errorf("round trip statement %d: got %q, want %q", i, got, statementToString(ss[i]))
+		}
+	}
+}
+
+func TestUngrinDelimiters(t *testing.T) {
+	input := `ini = {};
+ini.tool = {};
+ini.tool.name = "app";
+ini.tool.name@delimiter = ":";
+ini.tool.list = "\na\nb";
+ini.tool.list@delimiter = ":";
+ini.tool.url = "http://example.com:8080";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	tests := []struct {
+		ss   statements
+		want string
+	}{
+		{ss, "[tool]\nname: app\nlist:\n    a\n    b\nurl = http://example.com:8080\n"},
+		{withoutAttribute(ss, "delimiter"), "[tool]\nname = app\nlist =\n    a\n    b\nurl = http://example.com:8080\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := ungrinFromStatements(tt.ss, &buf); err != nil {
+			t.Fatalf("ungrinFromStatements error: %v", err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("ungrin output = %q, want %q", buf.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// yamlSpecial holds the plain scalars, lower-cased, that YAML 1.1 or 1.2
+// reads as booleans, nulls or special floats rather than strings.
+var yamlSpecial = map[string]bool{
+	"y":     true,
+	"n":     true,
+	"yes":   true,
+	"no":    true,
+	"true":  true,
+	"false": true,
+	"on":    true,
+	"off":   true,
+	"null":  true,
+	"~":     true,
+	".inf":  true,
+	"-.inf": true,
+	"+.inf": true,
+	".nan":  true,
+}
+
+// yamlFromStatements renders statements as a YAML mapping. Dotted section
+// names become nested mappings and repeated keys become sequences. Keys
+// and values are strings, quoted wherever YAML would read them otherwise;
+// with types, values that read as integers, floats or booleans are
+// written without quotes so that YAML reads them as such.
+// Keys are written in the order the statements present them.
+func yamlFromStatements(ss statements, w io.Writer, types bool) error {
+	root, err := treeFromStatements(ss)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if len(root.keys) == 0 {
+		b.WriteString("{}\n")
+	}
+	writeYAMLMapping(&b, root, 0, types)
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// writeYAMLMapping appends the keys of n to b at the given indentation
+// depth.
+func writeYAMLMapping(b *strings.Builder, n *node, depth int, types bool) {
+	indent := strings.Repeat("  ", depth)
+	for _, k := range n.keys {
+		c := n.children[k]
+		b.WriteString(indent)
+		b.WriteString(yamlScalar(k, false))
+		b.WriteByte(':')
+		switch {
+		case c.isLeaf:
+			b.WriteByte(' ')
+			b.WriteString(yamlValue(c, types))
+			b.WriteByte('\n')
+		case c.isArray:
+			b.WriteByte('\n')
+			for _, v := range c.sortedItems() {
+				b.WriteString(indent + "  - ")
+				b.WriteString(yamlValue(v, types))
+				b.WriteByte('\n')
+			}
+		case len(c.keys) == 0:
+			b.WriteString(" {}\n")
+		default:
+			b.WriteByte('\n')
+			writeYAMLMapping(b, c, depth+1, types)
+		}
+	}
+}
+
+// yamlValue formats the value of leaf as a YAML scalar, as a number or
+// boolean if --types gave it that type. Booleans are written as true or
+// false, which YAML 1.1 and 1.2 both read as booleans.
+func yamlValue(leaf *node, types bool) string {
+	switch leaf.typ {
+	case typNumber:
+		return leaf.value
+	case typBoolean:
+		b, _ := booleanValue(leaf.value)
+		return strconv.FormatBool(b)
+	}
+	return yamlScalar(leaf.value, types)
+}
+
+// yamlScalar formats s as a YAML scalar: plain where YAML reads it back as
+// the same string, in double quotes otherwise. With types, integers,
+// floats and booleans as TOML writes them, which YAML reads the same way,
+// are left plain.
+func yamlScalar(s string, types bool) string {
+	if types && isTOMLScalar(s) || !needsYAMLQuotes(s) {
+		return s
+	}
+	return strings.ReplaceAll(quoteString(s), "\x7f", `\x7F`)
+}
+
+// needsYAMLQuotes reports whether s must be quoted to be read as a string.
+// Besides booleans and nulls, that covers anything that starts like a
+// number, a date or a YAML indicator, has surrounding spaces, or holds a
+// sequence that starts a comment or a mapping value, or a character that
+// can't appear in a plain scalar. It errs on the side of quoting.
+func needsYAMLQuotes(s string) bool {
+	if s == "" || yamlSpecial[strings.ToLower(s)] {
+		return true
+	}
+	if strings.ContainsRune("-?:,[]{}#&*!|>'\"%@`0123456789+. ", rune(s[0])) {
+		return true
+	}
+	if strings.HasSuffix(s, " ") || strings.HasSuffix(s, ":") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return true
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestYAMLFromStatements(t *testing.T) {
+	input := `ini = {};
+ini.name = "web: main";
+ini.port = "5432";
+ini.feature = {};
+ini.feature.enabled = "yes";
+ini.feature.legacy = "off";
+ini.feature.mode = "0755";
+ini.feature.ratio = "0.5";
+ini.feature.flag = "true";
+ini.feature["on"] = "x";
+ini.database.pool.max = "20";
+ini.database.host = "db.example.com";
+ini.servers.hosts[1] = "b";
+ini.servers.hosts[0] = "a";
+ini.motd = "line one\nline two";
+ini.empty = {};
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+
+	tests := []struct {
+		types bool
+		want  string
+	}{
+		{false, `name: "web: main"
+port: "5432"
+feature:
+  enabled: "yes"
+  legacy: "off"
+  mode: "0755"
+  ratio: "0.5"
+  flag: "true"
+  "on": x
+database:
+  pool:
+    max: "20"
+  host: db.example.com
+servers:
+  hosts:
+    - a
+    - b
+motd: "line one\nline two"
+empty: {}
+`},
+		{true, `name: "web: main"
+port: 5432
+feature:
+  enabled: "yes"
+  legacy: "off"
+  mode: "0755"
+  ratio: 0.5
+  flag: true
+  "on": x
+database:
+  pool:
+    max: 20
+  host: db.example.com
+servers:
+  hosts:
+    - a
+    - b
+motd: "line one\nline two"
+empty: {}
+`},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := yamlFromStatements(ss, &buf, tt.types); err != nil {
+			t.Fatalf("yamlFromStatements error: %v", err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("yaml output with types %v:\ngot:\n%s\nwant:\n%s", tt.types, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestYAMLFromStatementsEmpty(t *testing.T) {
+	ss, err := ungrinStatements(strings.NewReader("ini = {};\n"))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := yamlFromStatements(ss, &buf, false); err != nil {
+		t.Fatalf("yamlFromStatements error: %v", err)
+	}
+	if buf.String() != "{}\n" {
+		t.Errorf("got %q, want an empty mapping", buf.String())
+	}
+}
+
+func TestYAMLFromStatementsConflict(t *testing.T) {
+	input := `ini.database = "x";
+ini.database.host = "y";
+`
+	ss, err := ungrinStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ungrinStatements error: %v", err)
+	}
+	if err := yamlFromStatements(ss, &bytes.Buffer{}, false); err == nil {
+		t.Error("expected error for conflicting assignments, got nil")
+	}
+}
+
+func TestNeedsYAMLQuotes(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"plain", false},
+		{"db.example.com", false},
+		{"/var/log/app.log", false},
+		{"a-b c", false},
+		{"http://x", false},
+		{"", true},
+		{"yes", true},
+		{"No", true},
+		{"ON", true},
+		{"y", true},
+		{"null", true},
+		{"~", true},
+		{".inf", true},
+		{"0755", true},
+		{"5432", true},
+		{"1e3", true},
+		{"2024-01-02", true},
+		{"-1", true},
+		{"+1", true},
+		{".5", true},
+		{"- item", true},
+		{"*alias", true},
+		{"&anchor", true},
+		{"!tag", true},
+		{"@handle", true},
+		{"'quoted'", true},
+		{"a: b", true},
+		{"key:", true},
+		{"a #b", true},
+		{" padded", true},
+		{"padded ", true},
+		{"tab\there", true},
+		{"line\nbreak", true},
+	}
+
+	for _, tt := range tests {
+		if got := needsYAMLQuotes(tt.s); got != tt.want {
+			t.Errorf("needsYAMLQuotes(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestYAMLScalar(t *testing.T) {
+	tests := []struct {
+		s     string
+		types bool
+		want  string
+	}{
+		{"plain", false, "plain"},
+		{"yes", false, `"yes"`},
+		{"yes", true, `"yes"`},
+		{"42", false, `"42"`},
+		{"42", true, "42"},
+		{"0755", true, `"0755"`},
+		{`say "hi"`, false, `say "hi"`},
+		{`"hi"`, false, `"\"hi\""`},
+		{"del\x7f", false, `"del\x7F"`},
+	}
+
+	for _, tt := range tests {
+		if got := yamlScalar(tt.s, tt.types); got != tt.want {
+			t.Errorf("yamlScalar(%q, %v) = %q, want %q", tt.s, tt.types, got, tt.want)
+		}
+	}
+}